@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dnsimple/strillone/internal/config"
+	"github.com/dnsimple/strillone/internal/dlq"
+	"github.com/dnsimple/strillone/internal/service"
+)
+
+const dlqUsage = `Usage: strillone dlq <command> [options] [id...]
+
+Manages the dead-letter queue of a running server through its admin API,
+authenticated with ADMIN_TOKEN.
+
+Commands:
+  list      List the dead letters.
+  redrive   Deliver the given dead letters again, or all of them with -all.
+  delete    Discard the given dead letters.
+
+Options:
+`
+
+// dlqClient calls the admin API of the dead-letter queue.
+type dlqClient struct {
+	server string
+	token  string
+	client *http.Client
+}
+
+// runDLQ runs the dlq subcommand, and returns the exit status.
+func runDLQ(args []string) int {
+	flags := flag.NewFlagSet("dlq", flag.ContinueOnError)
+	server := flags.String("server", "http://localhost:"+config.Config.WebServerPort, "The URL of the server.")
+	all := flags.Bool("all", false, "Redrive all the dead letters.")
+	destination := flags.String("destination", "", "Only redrive the dead letters of the destinations with this prefix, such as slack/T12345/B67890/, with -all.")
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), dlqUsage)
+		flags.PrintDefaults()
+	}
+
+	if len(args) == 0 {
+		flags.Usage()
+		return 2
+	}
+	command := args[0]
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	if config.Config.AdminToken == "" {
+		fmt.Fprintln(os.Stderr, "ADMIN_TOKEN is not set")
+		return 2
+	}
+	c := &dlqClient{
+		server: strings.TrimSuffix(*server, "/"),
+		token:  config.Config.AdminToken,
+		client: &http.Client{Timeout: time.Minute},
+	}
+
+	ids, err := parseIDs(flags.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	switch command {
+	case "list":
+		return c.list()
+	case "redrive":
+		if *all {
+			entries, err := c.entries()
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+			for _, entry := range entries {
+				if strings.HasPrefix(entry.Destination, *destination) {
+					ids = append(ids, entry.ID)
+				}
+			}
+		}
+		return c.each(ids, http.MethodPost, "/redrive", "Redriven")
+	case "delete":
+		return c.each(ids, http.MethodDelete, "", "Deleted")
+	default:
+		flags.Usage()
+		return 2
+	}
+}
+
+func (c *dlqClient) list() int {
+	entries, err := c.entries()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tREQUEST\tDESTINATION\tATTEMPTS\tFAILED AT\tLAST ERROR")
+	for _, entry := range entries {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%d\t%s\t%s\n", entry.ID, entry.RequestID, service.RedactDestination(entry.Destination), entry.Attempts, entry.FailedAt.Format(time.RFC3339), entry.LastError)
+	}
+	w.Flush()
+	return 0
+}
+
+func (c *dlqClient) entries() ([]dlq.Entry, error) {
+	resp, err := c.do(http.MethodGet, "/admin/dlq")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Data []dlq.Entry `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("parsing dead letters: %w", err)
+	}
+	return body.Data, nil
+}
+
+// each calls the action on every dead letter, and reports the failures
+// without stopping.
+func (c *dlqClient) each(ids []uint64, method, action, done string) int {
+	status := 0
+	for _, id := range ids {
+		resp, err := c.do(method, fmt.Sprintf("/admin/dlq/%d%s", id, action))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%d: %v\n", id, err)
+			status = 1
+			continue
+		}
+		resp.Body.Close()
+		fmt.Printf("%s %d\n", done, id)
+	}
+	return status
+}
+
+// do sends a request to the admin API, and returns an error unless the
+// response is successful.
+func (c *dlqClient) do(method, path string) (*http.Response, error) {
+	req, err := http.NewRequest(method, c.server+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(message)))
+	}
+	return resp, nil
+}
+
+func parseIDs(args []string) ([]uint64, error) {
+	ids := make([]uint64, 0, len(args))
+	for _, arg := range args {
+		id, err := strconv.ParseUint(arg, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid dead letter ID %q", arg)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
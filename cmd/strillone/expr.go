@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/dnsimple/dnsimple-go/v7/dnsimple/webhook"
+	"github.com/dnsimple/strillone/internal/routing"
+)
+
+const exprUsage = `Usage: strillone expr [options] <expression>
+
+Evaluates a routing expression against a sample webhook payload, read from
+the standard input or -payload, and prints the result.
+
+Options:
+`
+
+// runExpr runs the expr subcommand, and returns the exit status.
+func runExpr(args []string) int {
+	flags := flag.NewFlagSet("expr", flag.ContinueOnError)
+	payloadPath := flags.String("payload", "-", "The file of the webhook payload, - for the standard input.")
+	view := flags.Bool("view", false, "Print the view of the event the expression is evaluated against.")
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), exprUsage)
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	expression, err := routing.CompileExpression(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid expression: %v\n", err)
+		return 1
+	}
+
+	payload, err := readPayload(*payloadPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	event, err := webhook.ParseEvent(payload)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid payload: %v\n", err)
+		return 1
+	}
+
+	if *view {
+		variables, err := routing.EventView(event)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid payload: %v\n", err)
+			return 1
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(variables); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+
+	result, err := expression.Eval(event)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error evaluating the expression: %v\n", err)
+		return 1
+	}
+	fmt.Println(result)
+	return 0
+}
+
+func readPayload(path string) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(path)
+}
@@ -1,21 +1,428 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io/fs"
 	"log"
+	"maps"
 	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
 
+	"github.com/dnsimple/dnsimple-go/v7/dnsimple/webhook"
+	"github.com/dnsimple/strillone/internal/breaker"
 	"github.com/dnsimple/strillone/internal/config"
+	"github.com/dnsimple/strillone/internal/dedup"
+	"github.com/dnsimple/strillone/internal/dlq"
 	xhttp "github.com/dnsimple/strillone/internal/http"
+	"github.com/dnsimple/strillone/internal/outbound"
+	"github.com/dnsimple/strillone/internal/outbox"
+	"github.com/dnsimple/strillone/internal/replay"
+	"github.com/dnsimple/strillone/internal/routing"
+	"github.com/dnsimple/strillone/internal/schedule"
+	"github.com/dnsimple/strillone/internal/service"
+	"github.com/dnsimple/strillone/internal/throttle"
 )
 
 func main() {
-	server := xhttp.NewServer()
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "dlq":
+			os.Exit(runDLQ(os.Args[2:]))
+		case "expr":
+			os.Exit(runExpr(os.Args[2:]))
+		}
+	}
+
+	os.Exit(run())
+}
 
+// run serves until SIGTERM or SIGINT, and returns the exit status: 0 when
+// everything was drained, 1 when starting or serving failed or the grace
+// period ran out. The stores are closed in every case.
+func run() int {
 	log.Printf("Starting %s/%s", config.Program, config.Version)
 
+	store, err := newDedupStore()
+	if err != nil {
+		log.Printf("Error opening the dedup store: %v\n", err)
+		return 1
+	}
+	defer store.Close()
+
+	service.SetHTTPClient(outbound.NewClient(outbound.Options{
+		DialTimeout:           config.Config.OutboundDialTimeout,
+		TLSHandshakeTimeout:   config.Config.OutboundTLSTimeout,
+		ResponseHeaderTimeout: config.Config.OutboundResponseTimeout,
+		Timeout:               config.Config.OutboundTimeout,
+		MaxIdleConnsPerHost:   config.Config.OutboundMaxIdleConnsPerHost,
+		IdleConnTimeout:       config.Config.OutboundIdleConnTimeout,
+	}))
+
+	policy := service.DeliveryPolicy{
+		MaxAttempts:    config.Config.DeliveryMaxAttempts,
+		InitialBackoff: config.Config.DeliveryInitialBackoff,
+		MaxBackoff:     config.Config.DeliveryMaxBackoff,
+		AttemptTimeout: config.Config.DeliveryAttemptTimeout,
+	}
+
+	opts := []xhttp.Option{
+		xhttp.WithDedupStore(store),
+		xhttp.WithInFlightWait(config.Config.DedupInFlightWait),
+		xhttp.WithDeliveryPolicy(policy),
+	}
+	var breakers *breaker.Breakers
+	if config.Config.BreakerThreshold > 0 {
+		breakers = breaker.New(config.Config.BreakerThreshold, config.Config.BreakerCooldown, notifyFallback)
+		opts = append(opts, xhttp.WithBreakers(breakers))
+	}
+	var deadLetters *dlq.Queue
+	if config.Config.DLQPath != "" {
+		deadLetters, err = dlq.Open(config.Config.DLQPath)
+		if err != nil {
+			log.Printf("Error opening the dead-letter queue: %v\n", err)
+			return 1
+		}
+		defer deadLetters.Close()
+
+		opts = append(opts, xhttp.WithDeadLetterQueue(deadLetters))
+		if config.Config.AdminToken == "" {
+			log.Printf("The dead-letter queue admin API is disabled, as ADMIN_TOKEN is not set\n")
+		}
+	}
+	var windows *schedule.Store
+	if config.Config.SchedulePath != "" {
+		windows, err = schedule.Open(config.Config.SchedulePath)
+		if err != nil {
+			log.Printf("Error opening the schedule: %v\n", err)
+			return 1
+		}
+		defer windows.Close()
+
+		opts = append(opts, xhttp.WithSchedule(windows))
+		if config.Config.AdminToken == "" {
+			log.Printf("The maintenance windows admin API is disabled, as ADMIN_TOKEN is not set\n")
+		}
+	}
+	if config.Config.AdminToken != "" {
+		opts = append(opts, xhttp.WithAdminToken(config.Config.AdminToken))
+	}
+	var dispatcher *outbox.Dispatcher
+	if config.Config.OutboxPath != "" {
+		box, err := outbox.Open(config.Config.OutboxPath)
+		if err != nil {
+			log.Printf("Error opening the outbox: %v\n", err)
+			return 1
+		}
+		defer box.Close()
+
+		// The outbox has a larger retry budget, as nobody waits for it.
+		outboxPolicy := policy
+		outboxPolicy.MaxAttempts = config.Config.OutboxMaxAttempts
+		dispatcher = outbox.NewDispatcher(box, newDeliverFunc(breakers), config.Config.OutboxWorkers, outboxPolicy, deadLetters)
+		opts = append(opts, xhttp.WithOutbox(dispatcher))
+	}
+	var guard *replay.Guard
+	if config.Config.ReplayWindow > 0 || config.Config.ReplayStatePath != "" {
+		guard, err = replay.NewGuard(config.Config.ReplayWindow, config.Config.ReplayCapacity, config.Config.ReplayStatePath)
+		if err != nil {
+			log.Printf("Error loading the replay state: %v\n", err)
+			return 1
+		}
+		opts = append(opts, xhttp.WithReplayGuard(guard))
+	}
+	if config.Config.TLSClientACL != "" {
+		acl, err := xhttp.ParseClientACL(config.Config.TLSClientACL)
+		if err != nil {
+			log.Printf("Error parsing TLS_CLIENT_ACL: %v\n", err)
+			return 1
+		}
+		opts = append(opts, xhttp.WithClientACL(acl))
+	}
+	if config.Config.RateLimits != "" {
+		policies, err := xhttp.ParseRateLimits(config.Config.RateLimits)
+		if err != nil {
+			log.Printf("Error parsing RATE_LIMITS: %v\n", err)
+			return 1
+		}
+		opts = append(opts, xhttp.WithRateLimits(policies))
+	}
+	if config.Config.TrustProxy {
+		opts = append(opts, xhttp.WithTrustedProxy())
+	}
+	reloader, err := loadRoutes(config.Config.RoutingFile, func(routes *routing.Config) error {
+		if routes.UsesDigests() && windows == nil {
+			return errors.New("the digest quiet hours require SCHEDULE_PATH")
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error loading the routing configuration: %v\n", err)
+		return 1
+	}
+	events := throttle.New()
+	opts = append(opts, xhttp.WithRoutingReloader(reloader), xhttp.WithThrottle(events))
+	server := xhttp.NewServer(opts...)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
 	addr := config.Config.WebServerHost + ":" + config.Config.WebServerPort
-	log.Printf("WebServer listening on %s...\n", addr)
-	if err := http.ListenAndServe(addr, server); err != nil {
-		log.Fatal(err)
+	httpServer := newHTTPServer(addr, server)
+	if config.Config.TLSCertFile != "" && config.Config.TLSKeyFile != "" {
+		httpServer.TLSConfig, err = newTLSConfig(ctx)
+		if err != nil {
+			log.Printf("Error configuring TLS: %v\n", err)
+			return 1
+		}
+	}
+
+	// The outbox is only delivered once the configuration is valid, as a
+	// failed start doesn't stop the dispatcher.
+	if dispatcher != nil {
+		dispatcher.Start()
+	}
+
+	// The digests and the summaries are posted until the shutdown.
+	var digests sync.WaitGroup
+	go reloadRoutes(ctx, reloader)
+	digests.Go(func() { events.Run(ctx, config.Config.ThrottleSummaryInterval, service.Notify) })
+	if guard != nil {
+		go guard.Run(ctx, config.Config.ReplaySaveInterval)
+	}
+	if windows != nil {
+		digests.Go(func() { windows.Run(ctx, config.Config.DigestInterval, service.Notify) })
+	}
+
+	servers := []*http.Server{httpServer}
+	errs := make(chan error, 2)
+
+	if httpServer.TLSConfig == nil {
+		log.Printf("WebServer listening on %s...\n", addr)
+		go func() { errs <- httpServer.ListenAndServe() }()
+	} else {
+		if config.Config.TLSRedirectPort != "" {
+			redirectAddr := config.Config.WebServerHost + ":" + config.Config.TLSRedirectPort
+			redirectServer := newHTTPServer(redirectAddr, xhttp.RedirectHandler(config.Config.WebServerPort))
+			servers = append(servers, redirectServer)
+			log.Printf("WebServer redirecting %s to HTTPS...\n", redirectAddr)
+			go func() { errs <- redirectServer.ListenAndServe() }()
+		}
+
+		log.Printf("WebServer listening on %s (HTTPS)...\n", addr)
+		go func() { errs <- httpServer.ListenAndServeTLS("", "") }()
+	}
+
+	status := 0
+	select {
+	case <-ctx.Done():
+		log.Printf("Shutting down, draining for up to %v...\n", config.Config.ShutdownGracePeriod)
+	case err := <-errs:
+		log.Printf("Error serving: %v\n", err)
+		status = 1
+	}
+	// A second signal terminates right away.
+	stop()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), config.Config.ShutdownGracePeriod)
+	defer cancel()
+	if err := shutdown(shutdownCtx, servers, dispatcher); err != nil {
+		log.Printf("Error shutting down: %v\n", err)
+		status = 1
+	}
+	digests.Wait()
+	if guard != nil {
+		if err := guard.Close(); err != nil {
+			log.Printf("Error saving replay state: %v\n", err)
+		}
+	}
+
+	// The stores are closed by the deferred calls.
+	log.Printf("Stopped %s with status %d\n", config.Program, status)
+	return status
+}
+
+func newHTTPServer(addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: config.Config.WebServerReadHeaderTimeout,
+		ReadTimeout:       config.Config.WebServerReadTimeout,
+		WriteTimeout:      config.Config.WebServerWriteTimeout,
+		IdleTimeout:       config.Config.WebServerIdleTimeout,
+	}
+}
+
+// shutdown stops accepting connections, then waits for the in-flight
+// requests and the outbox deliveries to complete, until ctx is done. The
+// remaining connections are then closed, and the outbox deliveries canceled.
+// The undelivered events stay in the outbox for the next start, and the
+// outbox can be closed once shutdown returns.
+func shutdown(ctx context.Context, servers []*http.Server, dispatcher *outbox.Dispatcher) error {
+	var errs []error
+	for _, server := range servers {
+		if err := server.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("draining requests: %w", err))
+			server.Close()
+		}
+	}
+
+	if dispatcher != nil {
+		if err := dispatcher.Stop(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("draining outbox deliveries: %w", err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func newTLSConfig(ctx context.Context) (*tls.Config, error) {
+	minVersion, err := xhttp.ParseTLSVersion(config.Config.TLSMinVersion)
+	if err != nil {
+		return nil, err
+	}
+	cipherSuites, err := xhttp.ParseCipherSuites(config.Config.TLSCipherSuites)
+	if err != nil {
+		return nil, err
+	}
+	reloader, err := xhttp.NewCertReloader(config.Config.TLSCertFile, config.Config.TLSKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	go reloader.Watch(ctx, config.Config.TLSReloadInterval)
+
+	tlsConfig := xhttp.NewTLSConfig(reloader, minVersion, cipherSuites)
+	if config.Config.TLSClientCAFile != "" {
+		clientCAs, err := xhttp.LoadClientCAs(config.Config.TLSClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.ClientCAs = clientCAs
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		if config.Config.TLSClientRequired {
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+// newDeliverFunc returns the function delivering the outbox items, through
+// the circuit breakers when not nil.
+func newDeliverFunc(breakers *breaker.Breakers) outbox.DeliverFunc {
+	return func(ctx context.Context, item outbox.Item) error {
+		messaging, err := service.NewMessagingService(item.Destination, item.Style)
+		if err != nil {
+			return err
+		}
+		if breakers != nil {
+			messaging = breakers.Wrap(item.Destination, messaging)
+		}
+
+		event, err := webhook.ParseEvent(item.Payload)
+		if err != nil {
+			return fmt.Errorf("parsing event: %w", err)
+		}
+
+		_, err = messaging.PostEvent(ctx, event)
+		return err
+	}
+}
+
+// notifyFallback tells the fallback destination, if any, that the circuit of
+// a destination opened.
+func notifyFallback(destination string, err error) {
+	if config.Config.BreakerFallback == "" {
+		return
+	}
+
+	text := fmt.Sprintf("Strillone stopped delivering to %s for %v after it failed with: %v", service.RedactDestination(destination), config.Config.BreakerCooldown, err)
+	if config.Config.DLQPath != "" {
+		text += ". The events are kept in the dead-letter queue."
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := service.Notify(ctx, config.Config.BreakerFallback, text); err != nil {
+		log.Printf("Error notifying the fallback destination: %v\n", err)
+	}
+}
+
+// loadRoutes reads the routing configuration, which is optional: when the
+// file doesn't exist, nothing is routed until it is created.
+func loadRoutes(path string, check func(*routing.Config) error) (*routing.Reloader, error) {
+	reloader, err := routing.NewReloader(path, check)
+	if errors.Is(err, fs.ErrNotExist) {
+		log.Printf("Routing disabled until %s is created and reloaded\n", path)
+		return routing.NewPendingReloader(path, check), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	routes := reloader.Config()
+	log.Printf("Loaded %d routes to %d destinations from %s\n", len(routes.Routes), len(routes.Destinations), path)
+	for _, name := range slices.Sorted(maps.Keys(routes.Tenants)) {
+		tenant := routes.Tenants[name]
+		log.Printf("Loaded %d routes to %d destinations for the tenant %s\n", len(tenant.Routes), len(tenant.Destinations), name)
+	}
+	return reloader, nil
+}
+
+// reloadRoutes reloads the routing configuration on SIGHUP, and when its
+// file changes, until ctx is done.
+func reloadRoutes(ctx context.Context, reloader *routing.Reloader) {
+	if config.Config.RoutingWatch {
+		go func() {
+			if err := reloader.Watch(ctx); err != nil {
+				log.Printf("Error watching the routing configuration, reload it with SIGHUP: %v\n", err)
+			}
+		}()
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			log.Printf("Reloading the routing configuration on SIGHUP\n")
+			// The errors are logged, and the active configuration is kept.
+			_ = reloader.Reload()
+		}
+	}
+}
+
+func newDedupStore() (xhttp.DedupStore, error) {
+	if config.Config.DedupURL == "" {
+		return dedup.NewMemoryStore(config.Config.DedupTTL), nil
+	}
+
+	u, err := url.Parse(config.Config.DedupURL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing DEDUP_URL: %w", err)
+	}
+
+	switch u.Scheme {
+	case "bolt":
+		path := u.Path
+		if u.Opaque != "" {
+			path = u.Opaque
+		}
+		return dedup.NewBoltStore(path, config.Config.DedupTTL, config.Config.DedupClaimTTL, config.Config.DedupCompactionInterval)
+	case "redis", "rediss":
+		return dedup.NewRedisStore(config.Config.DedupURL, config.Config.DedupTTL, config.Config.DedupClaimTTL)
+	default:
+		return nil, fmt.Errorf("unsupported DEDUP_URL scheme %q", u.Scheme)
 	}
 }
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dnsimple/strillone/internal/outbox"
+	"github.com/dnsimple/strillone/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShutdown_SlowDispatcher(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.db")
+	box, err := outbox.Open(path)
+	require.NoError(t, err)
+
+	// The delivery only ends when it is canceled.
+	started := make(chan struct{})
+	var delivering atomic.Bool
+	slow := func(ctx context.Context, _ outbox.Item) error {
+		delivering.Store(true)
+		defer delivering.Store(false)
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	dispatcher := outbox.NewDispatcher(box, slow, 1, service.DeliveryPolicy{MaxAttempts: 3}, nil)
+	dispatcher.Start()
+	require.NoError(t, dispatcher.Enqueue("slow", []byte(`{}`), outbox.Delivery{Destination: "slack/-/-/-"}))
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = shutdown(ctx, []*http.Server{{}}, dispatcher)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// The worker is done, so the outbox can be closed, and the event is
+	// delivered on the next start.
+	assert.False(t, delivering.Load())
+	require.NoError(t, box.Close())
+
+	box, err = outbox.Open(path)
+	require.NoError(t, err)
+	defer box.Close()
+	items, err := box.Pending()
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.Equal(t, "slow", items[0].RequestID)
+	assert.Equal(t, 0, items[0].Attempts)
+}
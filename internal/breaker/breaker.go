@@ -0,0 +1,225 @@
+// Package breaker stops delivering events to destinations that keep failing,
+// such as a revoked Slack webhook or an archived channel.
+package breaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dnsimple/dnsimple-go/v7/dnsimple/webhook"
+	"github.com/dnsimple/strillone/internal/service"
+)
+
+// State is the state of the circuit of a destination.
+type State int
+
+const (
+	// Closed lets the deliveries through.
+	Closed State = iota
+	// Open rejects the deliveries until the cooldown is over.
+	Open
+	// HalfOpen lets a single delivery through to probe the destination.
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("State(%d)", int(s))
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (s State) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// ErrOpen is matched by the errors of the deliveries rejected by an open circuit.
+var ErrOpen = errors.New("circuit breaker open")
+
+// OpenError is returned instead of delivering to a destination with an open
+// circuit. It is permanent, so that the event is not retried.
+type OpenError struct {
+	Destination string
+	LastError   string
+}
+
+func (e *OpenError) Error() string {
+	return fmt.Sprintf("circuit breaker open for %s: %s", service.RedactDestination(e.Destination), e.LastError)
+}
+
+func (e *OpenError) Is(target error) bool {
+	return target == ErrOpen
+}
+
+// Retryable implements the interface checked by service.IsRetryable.
+func (e *OpenError) Retryable() bool {
+	return false
+}
+
+// Status is the state of the circuit of a destination, redacted.
+type Status struct {
+	Destination string    `json:"destination"`
+	State       State     `json:"state"`
+	Failures    int       `json:"failures"`
+	OpenedAt    time.Time `json:"opened_at,omitzero"`
+	LastError   string    `json:"last_error,omitempty"`
+}
+
+type circuit struct {
+	state     State
+	failures  int
+	openedAt  time.Time
+	lastError string
+}
+
+// Breakers keeps a circuit per destination.
+//
+// A circuit opens after threshold consecutive failed attempts, or right
+// away on a permanent error. Once cooldown is over, the circuit is half-open
+// and a single attempt probes the destination: the circuit closes if it
+// succeeds, and opens again otherwise.
+type Breakers struct {
+	threshold int
+	cooldown  time.Duration
+	onOpen    func(destination string, err error)
+
+	mu       sync.Mutex
+	circuits map[string]*circuit
+}
+
+// New returns the Breakers of the destinations. onOpen, when not nil, is
+// called in a goroutine when a closed circuit opens.
+func New(threshold int, cooldown time.Duration, onOpen func(destination string, err error)) *Breakers {
+	return &Breakers{
+		threshold: max(threshold, 1),
+		cooldown:  cooldown,
+		onOpen:    onOpen,
+		circuits:  make(map[string]*circuit),
+	}
+}
+
+// Allow returns an *OpenError unless a delivery to destination may be attempted.
+func (b *Breakers) Allow(destination string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c, ok := b.circuits[destination]
+	if !ok {
+		return nil
+	}
+
+	switch c.state {
+	case Open:
+		if time.Since(c.openedAt) < b.cooldown {
+			return &OpenError{Destination: destination, LastError: c.lastError}
+		}
+		c.state = HalfOpen
+		log.Printf("Probing destination %s\n", service.RedactDestination(destination))
+		return nil
+	case HalfOpen:
+		// A probe is already in flight.
+		return &OpenError{Destination: destination, LastError: c.lastError}
+	default:
+		return nil
+	}
+}
+
+// Success records a successful delivery to destination, and closes its circuit.
+func (b *Breakers) Success(destination string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if c, ok := b.circuits[destination]; ok {
+		if c.state != Closed {
+			log.Printf("Closing the circuit of destination %s\n", service.RedactDestination(destination))
+		}
+		delete(b.circuits, destination)
+	}
+}
+
+// Failure records a failed delivery to destination.
+func (b *Breakers) Failure(destination string, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c, ok := b.circuits[destination]
+	if !ok {
+		c = &circuit{}
+		b.circuits[destination] = c
+	}
+	c.failures++
+	c.lastError = err.Error()
+
+	switch {
+	case c.state == HalfOpen:
+		c.state = Open
+		c.openedAt = time.Now()
+		log.Printf("Probe of destination %s failed, keeping the circuit open: %v\n", service.RedactDestination(destination), err)
+	case c.state == Closed && (c.failures >= b.threshold || !service.IsRetryable(err)):
+		c.state = Open
+		c.openedAt = time.Now()
+		log.Printf("Opening the circuit of destination %s after %d failures: %v\n", service.RedactDestination(destination), c.failures, err)
+		if b.onOpen != nil {
+			go b.onOpen(destination, err)
+		}
+	}
+}
+
+// Status returns the circuits of the destinations with recent failures,
+// sorted by destination. The destinations are redacted, as the status is
+// served by the admin API.
+func (b *Breakers) Status() []Status {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	statuses := make([]Status, 0, len(b.circuits))
+	for destination, c := range b.circuits {
+		statuses = append(statuses, Status{
+			Destination: service.RedactDestination(destination),
+			State:       c.state,
+			Failures:    c.failures,
+			OpenedAt:    c.openedAt,
+			LastError:   c.lastError,
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Destination < statuses[j].Destination })
+	return statuses
+}
+
+// Wrap returns a MessagingService posting to s through the circuit of destination.
+func (b *Breakers) Wrap(destination string, s service.MessagingService) service.MessagingService {
+	return &breakerService{MessagingService: s, breakers: b, destination: destination}
+}
+
+type breakerService struct {
+	service.MessagingService
+	breakers    *Breakers
+	destination string
+}
+
+// PostEvent implements service.MessagingService.
+func (s *breakerService) PostEvent(ctx context.Context, event *webhook.Event) (string, error) {
+	if err := s.breakers.Allow(s.destination); err != nil {
+		return "", err
+	}
+
+	text, err := s.MessagingService.PostEvent(ctx, event)
+	if err != nil {
+		s.breakers.Failure(s.destination, err)
+		return "", err
+	}
+	s.breakers.Success(s.destination)
+	return text, nil
+}
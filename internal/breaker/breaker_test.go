@@ -0,0 +1,120 @@
+package breaker_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/dnsimple/dnsimple-go/v7/dnsimple/webhook"
+	"github.com/dnsimple/strillone/internal/breaker"
+	"github.com/dnsimple/strillone/internal/service"
+	"github.com/slack-go/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const destination = "slack/T1/B1/secret"
+
+var unavailable = slack.StatusCodeError{Code: http.StatusServiceUnavailable, Status: "503 Service Unavailable"}
+
+func TestBreakers_Threshold(t *testing.T) {
+	breakers := breaker.New(3, time.Hour, nil)
+
+	for range 2 {
+		require.NoError(t, breakers.Allow(destination))
+		breakers.Failure(destination, unavailable)
+	}
+	require.NoError(t, breakers.Allow(destination))
+
+	// A success resets the failures.
+	breakers.Success(destination)
+	assert.Empty(t, breakers.Status())
+
+	for range 3 {
+		require.NoError(t, breakers.Allow(destination))
+		breakers.Failure(destination, unavailable)
+	}
+
+	err := breakers.Allow(destination)
+	require.ErrorIs(t, err, breaker.ErrOpen)
+	assert.False(t, service.IsRetryable(err))
+	assert.Equal(t, "circuit breaker open for slack/T1/B1/…: slack server error: 503 Service Unavailable", err.Error())
+
+	// Other destinations are not affected.
+	assert.NoError(t, breakers.Allow("slack/T2/B2/other"))
+
+	status := breakers.Status()
+	require.Len(t, status, 1)
+	assert.Equal(t, "slack/T1/B1/…", status[0].Destination)
+	assert.Equal(t, breaker.Open, status[0].State)
+	assert.Equal(t, 3, status[0].Failures)
+}
+
+func TestBreakers_PermanentError(t *testing.T) {
+	opened := make(chan string, 1)
+	breakers := breaker.New(5, time.Hour, func(destination string, _ error) {
+		opened <- destination
+	})
+
+	breakers.Failure(destination, slack.StatusCodeError{Code: http.StatusNotFound, Status: "404 Not Found"})
+	assert.ErrorIs(t, breakers.Allow(destination), breaker.ErrOpen)
+
+	select {
+	case notified := <-opened:
+		assert.Equal(t, destination, notified)
+	case <-time.After(time.Second):
+		t.Fatal("the opening of the circuit was not notified")
+	}
+}
+
+func TestBreakers_HalfOpen(t *testing.T) {
+	breakers := breaker.New(1, 50*time.Millisecond, nil)
+	breakers.Failure(destination, unavailable)
+	require.ErrorIs(t, breakers.Allow(destination), breaker.ErrOpen)
+
+	// A single probe is let through after the cooldown.
+	time.Sleep(60 * time.Millisecond)
+	require.NoError(t, breakers.Allow(destination))
+	assert.ErrorIs(t, breakers.Allow(destination), breaker.ErrOpen)
+	assert.Equal(t, breaker.HalfOpen, breakers.Status()[0].State)
+
+	// A failed probe opens the circuit again.
+	breakers.Failure(destination, unavailable)
+	assert.ErrorIs(t, breakers.Allow(destination), breaker.ErrOpen)
+
+	// A successful probe closes it.
+	time.Sleep(60 * time.Millisecond)
+	require.NoError(t, breakers.Allow(destination))
+	breakers.Success(destination)
+	assert.NoError(t, breakers.Allow(destination))
+	assert.Empty(t, breakers.Status())
+}
+
+type failingService struct {
+	attempts int
+}
+
+func (*failingService) FormatLink(name, url string) string {
+	return name
+}
+
+func (s *failingService) PostEvent(_ context.Context, _ *webhook.Event) (string, error) {
+	s.attempts++
+	return "", errors.New("channel_is_archived")
+}
+
+func TestBreakers_Wrap(t *testing.T) {
+	breakers := breaker.New(5, time.Hour, nil)
+	failing := &failingService{}
+	messaging := breakers.Wrap(destination, failing)
+
+	_, err := messaging.PostEvent(context.Background(), &webhook.Event{})
+	assert.EqualError(t, err, "channel_is_archived")
+
+	// The open circuit short-circuits the delivery.
+	_, err = messaging.PostEvent(context.Background(), &webhook.Event{})
+	assert.ErrorIs(t, err, breaker.ErrOpen)
+	assert.Equal(t, 1, failing.attempts)
+}
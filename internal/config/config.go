@@ -2,6 +2,7 @@ package config
 
 import (
 	"log"
+	"time"
 
 	"github.com/caarlos0/env/v11"
 )
@@ -26,6 +27,86 @@ type Configuration struct {
 	WebServerHost string `env:"WEB_SERVER_HOST"` // Defaults to http.Server default.
 	WebServerPort string `env:"WEB_SERVER_PORT" envDefault:"4000"`
 	DNSimpleURL   string `env:"DNSIMPLE_URL" envDefault:"https://dnsimple.com"`
+
+	// Timeouts of the inbound requests.
+	WebServerReadHeaderTimeout time.Duration `env:"WEB_SERVER_READ_HEADER_TIMEOUT" envDefault:"5s"`
+	WebServerReadTimeout       time.Duration `env:"WEB_SERVER_READ_TIMEOUT" envDefault:"30s"`
+	WebServerWriteTimeout      time.Duration `env:"WEB_SERVER_WRITE_TIMEOUT" envDefault:"60s"` // Covers the synchronous deliveries.
+	WebServerIdleTimeout       time.Duration `env:"WEB_SERVER_IDLE_TIMEOUT" envDefault:"120s"`
+
+	// The outbound client shared by the publishers. The proxy is taken from HTTPS_PROXY.
+	OutboundDialTimeout         time.Duration `env:"OUTBOUND_DIAL_TIMEOUT" envDefault:"5s"`
+	OutboundTLSTimeout          time.Duration `env:"OUTBOUND_TLS_TIMEOUT" envDefault:"5s"`
+	OutboundResponseTimeout     time.Duration `env:"OUTBOUND_RESPONSE_TIMEOUT" envDefault:"10s"`
+	OutboundTimeout             time.Duration `env:"OUTBOUND_TIMEOUT" envDefault:"30s"`
+	OutboundMaxIdleConnsPerHost int           `env:"OUTBOUND_MAX_IDLE_CONNS_PER_HOST" envDefault:"16"`
+	OutboundIdleConnTimeout     time.Duration `env:"OUTBOUND_IDLE_CONN_TIMEOUT" envDefault:"90s"`
+
+	// Heroku kills the dyno 30 seconds after SIGTERM.
+	ShutdownGracePeriod time.Duration `env:"SHUTDOWN_GRACE_PERIOD" envDefault:"25s"`
+
+	// HTTPS is served when both the certificate and the key files are set.
+	TLSCertFile       string        `env:"TLS_CERT_FILE"`
+	TLSKeyFile        string        `env:"TLS_KEY_FILE"`
+	TLSMinVersion     string        `env:"TLS_MIN_VERSION" envDefault:"1.2"`
+	TLSCipherSuites   string        `env:"TLS_CIPHER_SUITES"` // Comma-separated, defaults to the Go defaults.
+	TLSReloadInterval time.Duration `env:"TLS_RELOAD_INTERVAL" envDefault:"1m"`
+	TLSRedirectPort   string        `env:"TLS_REDIRECT_PORT"` // Plain HTTP port redirecting to HTTPS, disabled when empty.
+
+	// Client certificates are verified when a CA bundle is set.
+	TLSClientCAFile   string `env:"TLS_CLIENT_CA_FILE"`
+	TLSClientRequired bool   `env:"TLS_CLIENT_REQUIRED"` // Reject clients without a certificate.
+	TLSClientACL      string `env:"TLS_CLIENT_ACL"`      // name=pattern,pattern;name=pattern
+
+	// Processed events are remembered in memory unless a store URL is set,
+	// such as bolt:///var/lib/strillone/dedup.db or redis://localhost:6379/0.
+	DedupURL                string        `env:"DEDUP_URL"`
+	DedupTTL                time.Duration `env:"DEDUP_TTL" envDefault:"5m"`
+	DedupCompactionInterval time.Duration `env:"DEDUP_COMPACTION_INTERVAL" envDefault:"10m"`
+	DedupClaimTTL           time.Duration `env:"DEDUP_CLAIM_TTL" envDefault:"1m"`
+	DedupInFlightWait       time.Duration `env:"DEDUP_IN_FLIGHT_WAIT"` // Skip concurrent duplicates right away when zero.
+
+	// Retries of the failed deliveries.
+	DeliveryMaxAttempts    int           `env:"DELIVERY_MAX_ATTEMPTS" envDefault:"3"`
+	DeliveryInitialBackoff time.Duration `env:"DELIVERY_INITIAL_BACKOFF" envDefault:"500ms"`
+	DeliveryMaxBackoff     time.Duration `env:"DELIVERY_MAX_BACKOFF" envDefault:"30s"`
+	DeliveryAttemptTimeout time.Duration `env:"DELIVERY_ATTEMPT_TIMEOUT" envDefault:"10s"`
+
+	// Events are delivered asynchronously when an outbox path is set.
+	OutboxPath        string `env:"OUTBOX_PATH"`
+	OutboxWorkers     int    `env:"OUTBOX_WORKERS" envDefault:"4"`
+	OutboxMaxAttempts int    `env:"OUTBOX_MAX_ATTEMPTS" envDefault:"10"`
+
+	// Undeliverable events are kept in a dead-letter queue when a path is set.
+	DLQPath    string `env:"DLQ_PATH"`
+	AdminToken string `env:"ADMIN_TOKEN"` // Bearer token of the admin API, disabled when empty.
+
+	// Circuit breakers stop delivering to the destinations that keep failing.
+	BreakerThreshold int           `env:"BREAKER_THRESHOLD" envDefault:"5"` // Consecutive failures, zero disables the breakers.
+	BreakerCooldown  time.Duration `env:"BREAKER_COOLDOWN" envDefault:"5m"`
+	BreakerFallback  string        `env:"BREAKER_FALLBACK"` // Destination notified when a circuit opens, such as slack/T/B/X.
+
+	// Routes of the events posted to /events/{token}, read when the file exists.
+	// Reloaded on SIGHUP, and when the file changes unless the watch is disabled.
+	RoutingFile  string `env:"ROUTING_FILE" envDefault:"strillone.yaml"`
+	RoutingWatch bool   `env:"ROUTING_WATCH" envDefault:"true"`
+
+	// How often the events dropped by the caps and the sampling of the routes are summarized.
+	ThrottleSummaryInterval time.Duration `env:"THROTTLE_SUMMARY_INTERVAL" envDefault:"1m"`
+
+	// Maintenance windows and digests are enabled when a schedule path is set.
+	SchedulePath   string        `env:"SCHEDULE_PATH"`
+	DigestInterval time.Duration `env:"DIGEST_INTERVAL" envDefault:"1m"` // How often the due digests are posted.
+
+	// Rate limits per route, e.g. "slack:client=5/s:20,destination=30/m".
+	RateLimits string `env:"RATE_LIMITS"`
+	TrustProxy bool   `env:"TRUST_PROXY"` // Take the client IP from X-Forwarded-For.
+
+	// The replay guard is enabled when either a window or a state path is set.
+	ReplayWindow       time.Duration `env:"REPLAY_WINDOW"` // Zero disables the timestamp check.
+	ReplayCapacity     int           `env:"REPLAY_CAPACITY" envDefault:"50000"`
+	ReplayStatePath    string        `env:"REPLAY_STATE_PATH"`                     // Empty keeps the seen IDs in memory only.
+	ReplaySaveInterval time.Duration `env:"REPLAY_SAVE_INTERVAL" envDefault:"10s"` // How often the seen IDs are persisted.
 }
 
 // LoadConfiguration loads environment variables into a Configuration struct.
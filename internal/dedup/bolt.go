@@ -0,0 +1,164 @@
+package dedup
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var processedBucket = []byte("processed")
+
+const (
+	boltClaimed byte = iota + 1
+	boltProcessed
+)
+
+// BoltStore keeps the processed request IDs in an embedded bbolt database,
+// so that they survive restarts. Each ID is stored with its status and
+// expiration time, and expired IDs are removed every compaction interval.
+type BoltStore struct {
+	db       *bolt.DB
+	ttl      time.Duration
+	claimTTL time.Duration
+
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// NewBoltStore opens or creates the database at path, remembering request IDs
+// for ttl. Claims that are neither marked nor released expire after claimTTL.
+// A zero compaction interval disables the periodic compaction.
+func NewBoltStore(path string, ttl, claimTTL, compactionInterval time.Duration) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("opening dedup store %s: %w", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(processedBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("initializing dedup store %s: %w", path, err)
+	}
+
+	s := &BoltStore{db: db, ttl: ttl, claimTTL: claimTTL, done: make(chan struct{})}
+	if compactionInterval > 0 {
+		s.wg.Add(1)
+		go s.compactEvery(compactionInterval)
+	}
+	return s, nil
+}
+
+// Claim implements http.DedupStore.
+func (s *BoltStore) Claim(requestID string) (Status, error) {
+	status := Claimed
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(processedBucket)
+		if value := bucket.Get([]byte(requestID)); value != nil && !expired(value, time.Now()) {
+			status = InFlight
+			if value[0] == boltProcessed {
+				status = Processed
+			}
+			return nil
+		}
+		return bucket.Put([]byte(requestID), boltValue(boltClaimed, s.claimTTL))
+	})
+	return status, err
+}
+
+// Mark implements http.DedupStore.
+func (s *BoltStore) Mark(requestID string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(processedBucket).Put([]byte(requestID), boltValue(boltProcessed, s.ttl))
+	})
+}
+
+// Release implements http.DedupStore.
+func (s *BoltStore) Release(requestID string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(processedBucket)
+		if value := bucket.Get([]byte(requestID)); value != nil && value[0] == boltClaimed {
+			return bucket.Delete([]byte(requestID))
+		}
+		return nil
+	})
+}
+
+// Compact removes the expired request IDs, and returns how many were removed.
+func (s *BoltStore) Compact() (int, error) {
+	var removed int
+	now := time.Now()
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(processedBucket)
+
+		var keys [][]byte
+		err := bucket.ForEach(func(k, v []byte) error {
+			if expired(v, now) {
+				keys = append(keys, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, k := range keys {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+		removed = len(keys)
+		return nil
+	})
+	return removed, err
+}
+
+// Close implements http.DedupStore.
+func (s *BoltStore) Close() error {
+	s.closeOnce.Do(func() { close(s.done) })
+	s.wg.Wait()
+	return s.db.Close()
+}
+
+func (s *BoltStore) compactEvery(interval time.Duration) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			if removed, err := s.Compact(); err != nil {
+				log.Printf("Error compacting dedup store: %v\n", err)
+			} else if removed > 0 {
+				log.Printf("Compacted dedup store, removed %d expired entries\n", removed)
+			}
+		}
+	}
+}
+
+// boltValue encodes the status followed by the expiration time.
+func boltValue(status byte, ttl time.Duration) []byte {
+	value := make([]byte, 9)
+	value[0] = status
+	binary.BigEndian.PutUint64(value[1:], uint64(time.Now().Add(ttl).UnixNano()))
+	return value
+}
+
+func expired(value []byte, now time.Time) bool {
+	if len(value) != 9 {
+		return true
+	}
+	return now.UnixNano() > int64(binary.BigEndian.Uint64(value[1:]))
+}
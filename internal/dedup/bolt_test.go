@@ -0,0 +1,81 @@
+package dedup_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dnsimple/strillone/internal/dedup"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBoltStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dedup.db")
+
+	store, err := dedup.NewBoltStore(path, time.Hour, time.Minute, 0)
+	require.NoError(t, err)
+
+	status, err := store.Claim("a")
+	require.NoError(t, err)
+	assert.Equal(t, dedup.Claimed, status)
+
+	status, err = store.Claim("a")
+	require.NoError(t, err)
+	assert.Equal(t, dedup.InFlight, status)
+
+	require.NoError(t, store.Mark("a"))
+	status, err = store.Claim("a")
+	require.NoError(t, err)
+	assert.Equal(t, dedup.Processed, status)
+	require.NoError(t, store.Close())
+
+	// The processed events survive a restart.
+	restarted, err := dedup.NewBoltStore(path, time.Hour, time.Minute, 0)
+	require.NoError(t, err)
+	defer restarted.Close()
+
+	status, err = restarted.Claim("a")
+	require.NoError(t, err)
+	assert.Equal(t, dedup.Processed, status)
+}
+
+func TestBoltStore_Release(t *testing.T) {
+	store, err := dedup.NewBoltStore(filepath.Join(t.TempDir(), "dedup.db"), time.Hour, time.Minute, 0)
+	require.NoError(t, err)
+	defer store.Close()
+
+	_, err = store.Claim("a")
+	require.NoError(t, err)
+	require.NoError(t, store.Release("a"))
+
+	status, err := store.Claim("a")
+	require.NoError(t, err)
+	assert.Equal(t, dedup.Claimed, status)
+
+	// A processed event can't be released.
+	require.NoError(t, store.Mark("a"))
+	require.NoError(t, store.Release("a"))
+	status, err = store.Claim("a")
+	require.NoError(t, err)
+	assert.Equal(t, dedup.Processed, status)
+}
+
+func TestBoltStore_Compact(t *testing.T) {
+	store, err := dedup.NewBoltStore(filepath.Join(t.TempDir(), "dedup.db"), time.Millisecond, time.Millisecond, 0)
+	require.NoError(t, err)
+	defer store.Close()
+
+	for _, id := range []string{"a", "b", "c"} {
+		require.NoError(t, store.Mark(id))
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	removed, err := store.Compact()
+	require.NoError(t, err)
+	assert.Equal(t, 3, removed)
+
+	status, err := store.Claim("a")
+	require.NoError(t, err)
+	assert.Equal(t, dedup.Claimed, status)
+}
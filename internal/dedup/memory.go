@@ -0,0 +1,95 @@
+// Package dedup provides the stores remembering which webhook events were
+// already processed, so that DNSimple retries are not published twice.
+package dedup
+
+import (
+	"sync"
+	"time"
+
+	"github.com/wunderlist/ttlcache"
+)
+
+// Status is the processing status of an event, as returned by a claim.
+type Status int
+
+const (
+	// Claimed means the event was claimed by the caller, who must either
+	// mark it as processed or release it.
+	Claimed Status = iota
+	// InFlight means the event is being processed by someone else.
+	InFlight
+	// Processed means the event was already processed.
+	Processed
+)
+
+// String implements fmt.Stringer.
+func (s Status) String() string {
+	switch s {
+	case Claimed:
+		return "claimed"
+	case InFlight:
+		return "in-flight"
+	case Processed:
+		return "processed"
+	default:
+		return "unknown"
+	}
+}
+
+const (
+	memoryClaimed   = "claimed"
+	memoryProcessed = "processed"
+)
+
+// MemoryStore keeps the processed request IDs in memory. They are lost on restart.
+type MemoryStore struct {
+	mu    sync.Mutex
+	cache *ttlcache.Cache
+}
+
+// NewMemoryStore returns a MemoryStore remembering request IDs for ttl.
+func NewMemoryStore(ttl time.Duration) *MemoryStore {
+	return &MemoryStore{cache: ttlcache.NewCache(ttl)}
+}
+
+// Claim implements http.DedupStore.
+func (s *MemoryStore) Claim(requestID string) (Status, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch value, _ := s.cache.Get(requestID); value {
+	case memoryProcessed:
+		return Processed, nil
+	case memoryClaimed:
+		return InFlight, nil
+	}
+
+	s.cache.Set(requestID, memoryClaimed)
+	return Claimed, nil
+}
+
+// Mark implements http.DedupStore.
+func (s *MemoryStore) Mark(requestID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cache.Set(requestID, memoryProcessed)
+	return nil
+}
+
+// Release implements http.DedupStore.
+func (s *MemoryStore) Release(requestID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// ttlcache can't delete items, an empty value is treated as absent.
+	if value, _ := s.cache.Get(requestID); value == memoryClaimed {
+		s.cache.Set(requestID, "")
+	}
+	return nil
+}
+
+// Close implements http.DedupStore.
+func (s *MemoryStore) Close() error {
+	return nil
+}
@@ -0,0 +1,77 @@
+package dedup_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/dnsimple/strillone/internal/dedup"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRedisStore(t *testing.T) (*dedup.RedisStore, *miniredis.Miniredis) {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	store, err := dedup.NewRedisStore("redis://"+server.Addr(), time.Hour, time.Minute)
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+	return store, server
+}
+
+func TestRedisStore_ClaimThenCommit(t *testing.T) {
+	replicaA, server := newRedisStore(t)
+	replicaB, err := dedup.NewRedisStore("redis://"+server.Addr(), time.Hour, time.Minute)
+	require.NoError(t, err)
+	defer replicaB.Close()
+
+	status, err := replicaA.Claim("a")
+	require.NoError(t, err)
+	assert.Equal(t, dedup.Claimed, status)
+
+	// The other replica can't claim the event, which is in flight.
+	status, err = replicaB.Claim("a")
+	require.NoError(t, err)
+	assert.Equal(t, dedup.InFlight, status)
+
+	require.NoError(t, replicaA.Mark("a"))
+	status, err = replicaB.Claim("a")
+	require.NoError(t, err)
+	assert.Equal(t, dedup.Processed, status)
+	assert.Equal(t, time.Hour, server.TTL("strillone:dedup:a"))
+
+	// A processed event can't be released.
+	require.NoError(t, replicaB.Release("a"))
+	status, err = replicaB.Claim("a")
+	require.NoError(t, err)
+	assert.Equal(t, dedup.Processed, status)
+}
+
+func TestRedisStore_Release(t *testing.T) {
+	store, _ := newRedisStore(t)
+
+	status, err := store.Claim("a")
+	require.NoError(t, err)
+	require.Equal(t, dedup.Claimed, status)
+	require.NoError(t, store.Release("a"))
+
+	status, err = store.Claim("a")
+	require.NoError(t, err)
+	assert.Equal(t, dedup.Claimed, status)
+}
+
+func TestRedisStore_ClaimExpires(t *testing.T) {
+	store, server := newRedisStore(t)
+
+	status, err := store.Claim("a")
+	require.NoError(t, err)
+	require.Equal(t, dedup.Claimed, status)
+
+	// The replica holding the claim died without committing nor releasing it.
+	server.FastForward(2 * time.Minute)
+
+	status, err = store.Claim("a")
+	require.NoError(t, err)
+	assert.Equal(t, dedup.Claimed, status)
+}
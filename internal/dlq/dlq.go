@@ -0,0 +1,146 @@
+// Package dlq keeps the events that could not be delivered, so that they can
+// be inspected and redriven once the destination is fixed.
+package dlq
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dnsimple/strillone/internal/service"
+	bolt "go.etcd.io/bbolt"
+)
+
+var entriesBucket = []byte("entries")
+
+// ErrNotFound is returned when an entry doesn't exist.
+var ErrNotFound = errors.New("dead letter not found")
+
+// Entry is an event that could not be delivered to its destination.
+type Entry struct {
+	// ID is assigned by the queue, in arrival order.
+	ID          uint64          `json:"id"`
+	RequestID   string          `json:"request_id"`
+	Destination string          `json:"destination"`
+	Style       service.Style   `json:"style,omitzero"`
+	Payload     json.RawMessage `json:"payload"`
+	Attempts    int             `json:"attempts"`
+	LastError   string          `json:"last_error"`
+	FailedAt    time.Time       `json:"failed_at"`
+}
+
+// Queue is a dead-letter queue backed by an embedded bbolt database.
+type Queue struct {
+	db *bolt.DB
+}
+
+// Open opens or creates the dead-letter database at path.
+func Open(path string) (*Queue, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("opening dead-letter queue %s: %w", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(entriesBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("initializing dead-letter queue %s: %w", path, err)
+	}
+
+	return &Queue{db: db}, nil
+}
+
+// Add persists a new entry, and returns it with its ID assigned.
+func (q *Queue) Add(entry Entry) (Entry, error) {
+	err := q.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(entriesBucket)
+
+		id, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		entry.ID = id
+		if entry.FailedAt.IsZero() {
+			entry.FailedAt = time.Now()
+		}
+
+		return putEntry(bucket, entry)
+	})
+	return entry, err
+}
+
+// Update replaces a stored entry.
+func (q *Queue) Update(entry Entry) error {
+	return q.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(entriesBucket)
+		if bucket.Get(entryKey(entry.ID)) == nil {
+			return ErrNotFound
+		}
+		return putEntry(bucket, entry)
+	})
+}
+
+// Get returns the entry with the given ID.
+func (q *Queue) Get(id uint64) (Entry, error) {
+	var entry Entry
+	err := q.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(entriesBucket).Get(entryKey(id))
+		if value == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(value, &entry)
+	})
+	return entry, err
+}
+
+// List returns all the stored entries, in arrival order.
+func (q *Queue) List() ([]Entry, error) {
+	entries := []Entry{}
+	err := q.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(entriesBucket).ForEach(func(_, v []byte) error {
+			var entry Entry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return err
+			}
+			entries = append(entries, entry)
+			return nil
+		})
+	})
+	return entries, err
+}
+
+// Delete removes an entry.
+func (q *Queue) Delete(id uint64) error {
+	return q.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(entriesBucket)
+		if bucket.Get(entryKey(id)) == nil {
+			return ErrNotFound
+		}
+		return bucket.Delete(entryKey(id))
+	})
+}
+
+// Close closes the database.
+func (q *Queue) Close() error {
+	return q.db.Close()
+}
+
+func putEntry(bucket *bolt.Bucket, entry Entry) error {
+	value, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return bucket.Put(entryKey(entry.ID), value)
+}
+
+// entryKey encodes the ID in big endian, so that the keys sort in arrival order.
+func entryKey(id uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, id)
+	return key
+}
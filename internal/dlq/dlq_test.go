@@ -0,0 +1,47 @@
+package dlq_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/dnsimple/strillone/internal/dlq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dlq.db")
+
+	queue, err := dlq.Open(path)
+	require.NoError(t, err)
+
+	first, err := queue.Add(dlq.Entry{RequestID: "a", Destination: "slack/-/-/-", Payload: []byte(`{}`), Attempts: 3, LastError: "channel_is_archived"})
+	require.NoError(t, err)
+	second, err := queue.Add(dlq.Entry{RequestID: "b", Destination: "slack/-/-/-", Payload: []byte(`{}`), Attempts: 1})
+	require.NoError(t, err)
+	assert.Less(t, first.ID, second.ID)
+	assert.False(t, first.FailedAt.IsZero())
+
+	second.Attempts = 2
+	require.NoError(t, queue.Update(second))
+	require.NoError(t, queue.Delete(first.ID))
+	assert.ErrorIs(t, queue.Delete(first.ID), dlq.ErrNotFound)
+	_, err = queue.Get(first.ID)
+	assert.ErrorIs(t, err, dlq.ErrNotFound)
+	require.NoError(t, queue.Close())
+
+	// The entries survive a restart.
+	queue, err = dlq.Open(path)
+	require.NoError(t, err)
+	defer queue.Close()
+
+	entries, err := queue.List()
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "b", entries[0].RequestID)
+	assert.Equal(t, 2, entries[0].Attempts)
+
+	entry, err := queue.Get(second.ID)
+	require.NoError(t, err)
+	assert.Equal(t, entries[0], entry)
+}
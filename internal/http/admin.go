@@ -0,0 +1,264 @@
+package http
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dnsimple/dnsimple-go/v7/dnsimple/webhook"
+	"github.com/dnsimple/strillone/internal/dlq"
+	"github.com/dnsimple/strillone/internal/outbox"
+	"github.com/dnsimple/strillone/internal/schedule"
+	"github.com/dnsimple/strillone/internal/service"
+)
+
+// admin requires the admin bearer token.
+func (s *Server) admin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// ListBreakers lists the circuits of the destinations with recent failures.
+func (s *Server) ListBreakers(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s\n", r.Method, r.URL.RequestURI())
+
+	writeJSON(w, http.StatusOK, s.breakers.Status())
+}
+
+// metrics are the expvar maps served by the admin API, leaving out the
+// command line and the memory stats.
+var metrics = []string{"outbound", "routing"}
+
+// Metrics describes the published metrics of the outbound requests and the
+// routing configuration.
+func (s *Server) Metrics(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s\n", r.Method, r.URL.RequestURI())
+
+	published := make(map[string]json.RawMessage, len(metrics))
+	for _, name := range metrics {
+		if v := expvar.Get(name); v != nil {
+			published[name] = json.RawMessage(v.String())
+		}
+	}
+	writeJSON(w, http.StatusOK, published)
+}
+
+// ListDeadLetters lists the events in the dead-letter queue.
+func (s *Server) ListDeadLetters(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s\n", r.Method, r.URL.RequestURI())
+
+	entries, err := s.deadLetters.List()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Printf("Error listing dead letters: %v\n", err)
+		return
+	}
+
+	// The destinations hold the secret of their webhook.
+	for i := range entries {
+		entries[i].Destination = service.RedactDestination(entries[i].Destination)
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
+
+// RedriveDeadLetter delivers an event of the dead-letter queue again, and
+// removes it from the queue once delivered or queued in the outbox.
+func (s *Server) RedriveDeadLetter(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s\n", r.Method, r.URL.RequestURI())
+
+	entry, ok := s.deadLetterEntry(w, r)
+	if !ok {
+		return
+	}
+
+	if s.outbox != nil {
+		if err := s.outbox.Enqueue(entry.RequestID, entry.Payload, outbox.Delivery{Destination: entry.Destination, Style: entry.Style}); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			log.Printf("Error queuing dead letter %d: %v\n", entry.ID, err)
+			return
+		}
+		s.removeDeadLetter(entry)
+		w.Header().Set(HeaderProcessingStatus, "queued")
+		writeJSON(w, http.StatusAccepted, entry)
+		return
+	}
+
+	if err := s.redrive(r, entry); err != nil {
+		entry.Attempts += attempts(err)
+		entry.LastError = err.Error()
+		entry.FailedAt = time.Now()
+		if err := s.deadLetters.Update(entry); err != nil {
+			log.Printf("Error updating dead letter %d: %v\n", entry.ID, err)
+		}
+
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		log.Printf("Error redriving dead letter %d: %v\n", entry.ID, err)
+		return
+	}
+
+	s.removeDeadLetter(entry)
+	w.Header().Set(HeaderProcessingStatus, "delivered")
+	writeJSON(w, http.StatusOK, entry)
+}
+
+// DeleteDeadLetter discards an event of the dead-letter queue.
+func (s *Server) DeleteDeadLetter(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s\n", r.Method, r.URL.RequestURI())
+
+	entry, ok := s.deadLetterEntry(w, r)
+	if !ok {
+		return
+	}
+
+	if err := s.deadLetters.Delete(entry.ID); err != nil && !errors.Is(err, dlq.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Printf("Error deleting dead letter %d: %v\n", entry.ID, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListWindows lists the maintenance windows.
+func (s *Server) ListWindows(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s\n", r.Method, r.URL.RequestURI())
+
+	windows, err := s.schedule.Windows()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Printf("Error listing maintenance windows: %v\n", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, windows)
+}
+
+// CreateWindow creates a maintenance window.
+func (s *Server) CreateWindow(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s\n", r.Method, r.URL.RequestURI())
+
+	var window schedule.Window
+	if err := json.NewDecoder(r.Body).Decode(&window); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	window.ID = 0
+	if err := window.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	window, err := s.schedule.AddWindow(window)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Printf("Error creating maintenance window: %v\n", err)
+		return
+	}
+
+	log.Printf("Created maintenance window %d %q from %s to %s (%s)\n", window.ID, window.Name, window.StartsAt.Format(time.RFC3339), window.EndsAt.Format(time.RFC3339), window.Mode)
+	writeJSON(w, http.StatusCreated, window)
+}
+
+// DeleteWindow deletes a maintenance window.
+func (s *Server) DeleteWindow(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s\n", r.Method, r.URL.RequestURI())
+
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	err = s.schedule.DeleteWindow(id)
+	if errors.Is(err, schedule.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Printf("Error deleting maintenance window %d: %v\n", id, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RoutingStatus describes the active routing configuration and its reloads.
+func (s *Server) RoutingStatus(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s\n", r.Method, r.URL.RequestURI())
+
+	writeJSON(w, http.StatusOK, s.reloader.Status())
+}
+
+// ReloadRouting reloads the routing configuration. An invalid configuration
+// is rejected with a 422, and the active one is kept.
+func (s *Server) ReloadRouting(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s\n", r.Method, r.URL.RequestURI())
+
+	if err := s.reloader.Reload(); err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.reloader.Status())
+}
+
+// deadLetterEntry returns the entry of the request path, or writes the error.
+func (s *Server) deadLetterEntry(w http.ResponseWriter, r *http.Request) (dlq.Entry, bool) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return dlq.Entry{}, false
+	}
+
+	entry, err := s.deadLetters.Get(id)
+	if errors.Is(err, dlq.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return dlq.Entry{}, false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Printf("Error reading dead letter %d: %v\n", id, err)
+		return dlq.Entry{}, false
+	}
+	return entry, true
+}
+
+// redrive delivers a dead letter with the delivery policy.
+func (s *Server) redrive(r *http.Request, entry dlq.Entry) error {
+	event, err := webhook.ParseEvent(entry.Payload)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.post(r.Context(), entry.Destination, entry.Style, event)
+	return err
+}
+
+func (s *Server) removeDeadLetter(entry dlq.Entry) {
+	if err := s.deadLetters.Delete(entry.ID); err != nil && !errors.Is(err, dlq.ErrNotFound) {
+		log.Printf("Error removing redriven dead letter %d: %v\n", entry.ID, err)
+	}
+}
+
+// writeJSON writes data in the envelope of the DNSimple API.
+func writeJSON(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(map[string]any{"data": data}); err != nil {
+		log.Printf("Error writing response: %v\n", err)
+	}
+}
@@ -0,0 +1,354 @@
+package http_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dnsimple/strillone/internal/breaker"
+	"github.com/dnsimple/strillone/internal/dlq"
+	appServer "github.com/dnsimple/strillone/internal/http"
+	_ "github.com/dnsimple/strillone/internal/outbound" // Publishes the outbound metrics.
+	"github.com/dnsimple/strillone/internal/routing"
+	"github.com/dnsimple/strillone/internal/schedule"
+	"github.com/dnsimple/strillone/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const adminToken = "secret"
+
+func openDeadLetters(t *testing.T) *dlq.Queue {
+	t.Helper()
+
+	queue, err := dlq.Open(filepath.Join(t.TempDir(), "dlq.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { queue.Close() })
+	return queue
+}
+
+func adminRequest(t *testing.T, server http.Handler, method, path string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	request, _ := http.NewRequest(method, path, nil)
+	request.Header.Set("Authorization", "Bearer "+adminToken)
+	response := httptest.NewRecorder()
+	server.ServeHTTP(response, request)
+	return response
+}
+
+// fakeSlack answers the Slack webhooks with handler, instead of hooks.slack.com.
+func fakeSlack(t *testing.T, handler http.HandlerFunc) {
+	t.Helper()
+
+	slack := httptest.NewServer(handler)
+	t.Cleanup(slack.Close)
+
+	target, err := url.Parse(slack.URL)
+	require.NoError(t, err)
+	transport := slack.Client().Transport
+	service.SetHTTPClient(&http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		r = r.Clone(r.Context())
+		r.URL.Scheme, r.URL.Host = target.Scheme, target.Host
+		return transport.RoundTrip(r)
+	})})
+	t.Cleanup(func() { service.SetHTTPClient(http.DefaultClient) })
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestSlackDeadLetter(t *testing.T) {
+	fakeSlack(t, func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "no_service", http.StatusNotFound)
+	})
+	deadLetters := openDeadLetters(t)
+	server := appServer.NewServer(appServer.WithDeadLetterQueue(deadLetters))
+
+	// The webhook is unknown to Slack.
+	payload := `{"data": {"domain": {"id": 1, "name": "example.com"}}, "name": "domain.create", "request_identifier": "2c4e6a8b-0d1f-4a3c-9e5b-7d9f1b3d5e70"}`
+	request, _ := http.NewRequest("POST", "/slack/T1/B1/C1", strings.NewReader(payload))
+	response := httptest.NewRecorder()
+	server.ServeHTTP(response, request)
+
+	assert.Equal(t, http.StatusAccepted, response.Code)
+	assert.Equal(t, "dead-lettered", response.Header().Get(appServer.HeaderProcessingStatus))
+
+	entries, err := deadLetters.List()
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "2c4e6a8b-0d1f-4a3c-9e5b-7d9f1b3d5e70", entries[0].RequestID)
+	assert.Equal(t, "slack/T1/B1/C1", entries[0].Destination)
+	assert.JSONEq(t, payload, string(entries[0].Payload))
+	assert.Equal(t, 1, entries[0].Attempts)
+	assert.NotEmpty(t, entries[0].LastError)
+}
+
+func TestSlackCircuitOpen(t *testing.T) {
+	breakers := breaker.New(1, time.Hour, nil)
+	breakers.Failure("slack/T1/B1/C1", errors.New("channel_is_archived"))
+	payload := `{"data": {"domain": {"id": 1, "name": "example.com"}}, "name": "domain.create", "request_identifier": "4e6a8c0d-2f3b-4c5e-9a7d-9f1b3d5f7a92"}`
+
+	// Without a dead-letter queue, the sender retries later.
+	server := appServer.NewServer(appServer.WithBreakers(breakers))
+	request, _ := http.NewRequest("POST", "/slack/T1/B1/C1", strings.NewReader(payload))
+	response := httptest.NewRecorder()
+	server.ServeHTTP(response, request)
+	assert.Equal(t, http.StatusServiceUnavailable, response.Code)
+
+	deadLetters := openDeadLetters(t)
+	server = appServer.NewServer(appServer.WithBreakers(breakers), appServer.WithDeadLetterQueue(deadLetters))
+	request, _ = http.NewRequest("POST", "/slack/T1/B1/C1", strings.NewReader(payload))
+	response = httptest.NewRecorder()
+	server.ServeHTTP(response, request)
+	assert.Equal(t, http.StatusAccepted, response.Code)
+	assert.Equal(t, "dead-lettered", response.Header().Get(appServer.HeaderProcessingStatus))
+
+	entries, err := deadLetters.List()
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, 0, entries[0].Attempts)
+	assert.Contains(t, entries[0].LastError, "circuit breaker open")
+}
+
+func TestAdminDeadLetters(t *testing.T) {
+	deadLetters := openDeadLetters(t)
+	server := appServer.NewServer(appServer.WithDeadLetterQueue(deadLetters), appServer.WithAdminToken(adminToken))
+
+	payload := `{"data": {"domain": {"id": 1, "name": "example.com"}}, "name": "domain.create", "request_identifier": "3d5f7b9c-1e2a-4b4d-8f6c-8e0a2c4e6f81"}`
+	redriven, err := deadLetters.Add(dlq.Entry{RequestID: "a", Destination: "slack/-/-/-", Payload: []byte(payload), Attempts: 3})
+	require.NoError(t, err)
+	deleted, err := deadLetters.Add(dlq.Entry{RequestID: "b", Destination: "slack/-/-/-", Payload: []byte(payload), Attempts: 1})
+	require.NoError(t, err)
+
+	t.Run("unauthorized", func(t *testing.T) {
+		request, _ := http.NewRequest("GET", "/admin/dlq", nil)
+		request.Header.Set("Authorization", "Bearer wrong")
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		assert.Equal(t, http.StatusUnauthorized, response.Code)
+	})
+
+	t.Run("list", func(t *testing.T) {
+		response := adminRequest(t, server, "GET", "/admin/dlq")
+		require.Equal(t, http.StatusOK, response.Code)
+
+		var body struct {
+			Data []dlq.Entry `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(response.Body.Bytes(), &body))
+		require.Len(t, body.Data, 2)
+		assert.Equal(t, "a", body.Data[0].RequestID)
+		assert.Equal(t, "slack/-/-/…", body.Data[0].Destination)
+		assert.Equal(t, 3, body.Data[0].Attempts)
+	})
+
+	t.Run("redrive", func(t *testing.T) {
+		response := adminRequest(t, server, "POST", fmt.Sprintf("/admin/dlq/%d/redrive", redriven.ID))
+		assert.Equal(t, http.StatusOK, response.Code)
+		assert.Equal(t, "delivered", response.Header().Get(appServer.HeaderProcessingStatus))
+
+		_, err := deadLetters.Get(redriven.ID)
+		assert.ErrorIs(t, err, dlq.ErrNotFound)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		response := adminRequest(t, server, "DELETE", fmt.Sprintf("/admin/dlq/%d", deleted.ID))
+		assert.Equal(t, http.StatusNoContent, response.Code)
+
+		response = adminRequest(t, server, "DELETE", fmt.Sprintf("/admin/dlq/%d", deleted.ID))
+		assert.Equal(t, http.StatusNotFound, response.Code)
+	})
+}
+
+func TestAdminDisabled(t *testing.T) {
+	server := appServer.NewServer(appServer.WithDeadLetterQueue(openDeadLetters(t)))
+
+	// Served by the root handler.
+	response := adminRequest(t, server, "GET", "/admin/dlq")
+	assert.Contains(t, response.Body.String(), `"ping"`)
+
+	response = adminRequest(t, server, "DELETE", "/admin/dlq/1")
+	assert.Equal(t, http.StatusMethodNotAllowed, response.Code)
+}
+
+func TestAdminBreakers(t *testing.T) {
+	breakers := breaker.New(1, time.Hour, nil)
+	breakers.Failure("slack/T1/B1/C1", errors.New("channel_is_archived"))
+	server := appServer.NewServer(appServer.WithBreakers(breakers), appServer.WithAdminToken(adminToken))
+
+	response := adminRequest(t, server, "GET", "/admin/breakers")
+	require.Equal(t, http.StatusOK, response.Code)
+
+	var body struct {
+		Data []map[string]any `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &body))
+	require.Len(t, body.Data, 1)
+	assert.Equal(t, "slack/T1/B1/…", body.Data[0]["destination"])
+	assert.Equal(t, "open", body.Data[0]["state"])
+	assert.Equal(t, "channel_is_archived", body.Data[0]["last_error"])
+}
+
+func TestAdminMetrics(t *testing.T) {
+	server := appServer.NewServer(appServer.WithAdminToken(adminToken))
+
+	response := adminRequest(t, server, "GET", "/admin/metrics")
+	require.Equal(t, http.StatusOK, response.Code)
+
+	var body struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &body))
+	assert.Contains(t, body.Data, "outbound")
+	assert.Contains(t, body.Data, "routing")
+	assert.NotContains(t, body.Data, "memstats")
+	assert.NotContains(t, body.Data, "cmdline")
+}
+
+func openSchedule(t *testing.T) *schedule.Store {
+	t.Helper()
+
+	store, err := schedule.Open(filepath.Join(t.TempDir(), "schedule.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func createWindow(t *testing.T, server http.Handler, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	request, _ := http.NewRequest("POST", "/admin/windows", strings.NewReader(body))
+	request.Header.Set("Authorization", "Bearer "+adminToken)
+	response := httptest.NewRecorder()
+	server.ServeHTTP(response, request)
+	return response
+}
+
+func TestAdminWindows(t *testing.T) {
+	server := appServer.NewServer(appServer.WithSchedule(openSchedule(t)), appServer.WithAdminToken(adminToken))
+
+	response := createWindow(t, server, `{"name": "migration", "destinations": ["ops"], "starts_at": "2026-10-19T10:00:00Z", "ends_at": "2026-10-19T12:00:00Z", "mode": "digest"}`)
+	require.Equal(t, http.StatusCreated, response.Code)
+	assert.Contains(t, response.Body.String(), `"id":1`)
+
+	response = createWindow(t, server, `{"name": "backwards", "starts_at": "2026-10-19T12:00:00Z", "ends_at": "2026-10-19T10:00:00Z", "mode": "silent"}`)
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.Equal(t, "ends_at: must be after starts_at\n", response.Body.String())
+
+	response = adminRequest(t, server, "GET", "/admin/windows")
+	require.Equal(t, http.StatusOK, response.Code)
+	var body struct {
+		Data []schedule.Window `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &body))
+	require.Len(t, body.Data, 1)
+	assert.Equal(t, "migration", body.Data[0].Name)
+	assert.Equal(t, schedule.Digest, body.Data[0].Mode)
+
+	response = adminRequest(t, server, "DELETE", "/admin/windows/1")
+	assert.Equal(t, http.StatusNoContent, response.Code)
+	response = adminRequest(t, server, "DELETE", "/admin/windows/1")
+	assert.Equal(t, http.StatusNotFound, response.Code)
+}
+
+func TestMaintenanceWindows(t *testing.T) {
+	store := openSchedule(t)
+	box := &testOutbox{}
+	server := appServer.NewServer(appServer.WithSchedule(store), appServer.WithOutbox(box), appServer.WithAdminToken(adminToken))
+
+	tests := []struct {
+		mode    schedule.Mode
+		status  string
+		targets []string
+	}{
+		{mode: schedule.Silent, status: "queued", targets: []string{"slack/T1/B1/C1"}},
+		{mode: schedule.Digest, status: "deferred"},
+		{mode: schedule.Suppress, status: "skipped;suppressed"},
+	}
+	for i, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			now := time.Now()
+			window := fmt.Sprintf(`{"name": "%s", "destinations": ["slack/T1/*/*"], "starts_at": %q, "ends_at": %q, "mode": %q}`,
+				tt.mode, now.Add(-time.Minute).Format(time.RFC3339), now.Add(time.Hour).Format(time.RFC3339), tt.mode)
+			response := createWindow(t, server, window)
+			require.Equal(t, http.StatusCreated, response.Code)
+			t.Cleanup(func() { store.DeleteWindow(uint64(i + 1)) })
+
+			box.destinations, box.styles = nil, nil
+			payload := fmt.Sprintf(`{"data": {"domain": {"id": 1, "name": "example.com"}}, "name": "domain.create", "request_identifier": "window-%d"}`, i)
+			request, _ := http.NewRequest("POST", "/slack/T1/B1/C1", strings.NewReader(payload))
+			response = httptest.NewRecorder()
+			server.ServeHTTP(response, request)
+
+			assert.Equal(t, tt.status, response.Header().Get(appServer.HeaderProcessingStatus))
+			assert.Equal(t, tt.targets, box.destinations)
+			for _, style := range box.styles {
+				assert.True(t, style.Quiet)
+			}
+		})
+	}
+
+	due, err := store.Due(time.Now().Add(2 * time.Hour))
+	require.NoError(t, err)
+	require.Len(t, due, 1)
+	assert.Equal(t, "slack/T1/B1/C1", due[0].Destination)
+	assert.Equal(t, `maintenance window "digest"`, due[0].Label)
+	assert.Contains(t, due[0].Text, "created the domain")
+}
+
+func TestAdminRouting(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "strillone.yaml")
+	writeRoutes := func(token string) {
+		config := fmt.Sprintf("token: %s\ndestinations:\n  ops:\n    type: slack\n    url: https://hooks.slack.com/services/T1/B1/ops\ndefault: [ops]\n", token)
+		require.NoError(t, os.WriteFile(path, []byte(config), 0o600))
+	}
+	postEvent := func(server http.Handler, token, requestID string) *httptest.ResponseRecorder {
+		payload := fmt.Sprintf(`{"data": {"domain": {"id": 1, "name": "example.com"}}, "name": "domain.create", "request_identifier": %q}`, requestID)
+		request, _ := http.NewRequest("POST", "/events/"+token, strings.NewReader(payload))
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		return response
+	}
+
+	writeRoutes("first")
+	reloader, err := routing.NewReloader(path, nil)
+	require.NoError(t, err)
+	server := appServer.NewServer(appServer.WithRoutingReloader(reloader), appServer.WithOutbox(&testOutbox{}), appServer.WithAdminToken(adminToken))
+
+	response := adminRequest(t, server, "GET", "/admin/routing")
+	require.Equal(t, http.StatusOK, response.Code)
+	var body struct {
+		Data routing.ReloadStatus `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &body))
+	assert.Equal(t, path, body.Data.Path)
+	assert.Equal(t, http.StatusAccepted, postEvent(server, "first", "admin-routing-1").Code)
+
+	// An invalid configuration is rejected, and the active one is kept.
+	require.NoError(t, os.WriteFile(path, []byte("token: ["), 0o600))
+	response = adminRequest(t, server, "POST", "/admin/routing/reload")
+	assert.Equal(t, http.StatusUnprocessableEntity, response.Code)
+	assert.Equal(t, http.StatusAccepted, postEvent(server, "first", "admin-routing-2").Code)
+
+	writeRoutes("second")
+	response = adminRequest(t, server, "POST", "/admin/routing/reload")
+	require.Equal(t, http.StatusOK, response.Code)
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &body))
+	assert.Equal(t, int64(1), body.Data.Reloads)
+	assert.Equal(t, int64(1), body.Data.Failures)
+	assert.Equal(t, http.StatusNotFound, postEvent(server, "first", "admin-routing-3").Code)
+	assert.Equal(t, http.StatusAccepted, postEvent(server, "second", "admin-routing-4").Code)
+}
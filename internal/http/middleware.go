@@ -0,0 +1,77 @@
+package http
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"strings"
+)
+
+// HeaderRequestID is the header used to correlate a request with the logs.
+const HeaderRequestID = "X-Request-Id"
+
+type contextKey string
+
+const requestIDContextKey contextKey = "request-id"
+
+// RequestID returns the identifier assigned to the request by WithRequestID,
+// or an empty string if the request didn't go through the middleware.
+func RequestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDContextKey).(string)
+	return id
+}
+
+// WithRequestID assigns an identifier to every request, reusing the inbound
+// X-Request-Id header when present, and echoes it back in the response.
+func WithRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(HeaderRequestID)
+		if id == "" {
+			id = newRequestID()
+		}
+
+		w.Header().Set(HeaderRequestID, id)
+		ctx := context.WithValue(r.Context(), requestIDContextKey, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Recover turns a panic in the wrapped handler into a logged 500 response,
+// so that a single malformed payload can't take the process down.
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			if rec == http.ErrAbortHandler { //nolint:errorlint // sentinel value re-panicked as-is
+				panic(rec)
+			}
+
+			log.Printf("[request:%s] Panic serving %s %s: %v\n%s", RequestID(r), r.Method, redactPath(r.URL.Path), rec, debug.Stack())
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// redactPath hides the token of the /events paths, which is a secret.
+func redactPath(path string) string {
+	if strings.HasPrefix(path, "/events/") {
+		return "/events/…"
+	}
+	return path
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,174 @@
+package http
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+const clientIdentityContextKey contextKey = "client-identity"
+
+// ClientIdentity is the identity of a client authenticated with a verified
+// TLS client certificate.
+type ClientIdentity struct {
+	Subject    string
+	CommonName string
+	DNSNames   []string
+	URIs       []string
+	Emails     []string
+}
+
+// Names returns all the names the client can be referred to by in a ClientACL.
+func (id *ClientIdentity) Names() []string {
+	names := []string{id.Subject, id.CommonName}
+	names = append(names, id.DNSNames...)
+	names = append(names, id.URIs...)
+	return append(names, id.Emails...)
+}
+
+// String implements fmt.Stringer.
+func (id *ClientIdentity) String() string {
+	return id.Subject
+}
+
+// ClientIdentityFromRequest returns the identity of the client that sent the
+// request, if the request went through WithClientIdentity and the client
+// presented a verified certificate.
+func ClientIdentityFromRequest(r *http.Request) (*ClientIdentity, bool) {
+	id, ok := r.Context().Value(clientIdentityContextKey).(*ClientIdentity)
+	return id, ok
+}
+
+// WithClientIdentity exposes the identity from the verified client certificate
+// to the handlers. Requests without a verified certificate are passed as-is.
+func WithClientIdentity(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cert := r.TLS.VerifiedChains[0][0]
+		id := &ClientIdentity{
+			Subject:    cert.Subject.String(),
+			CommonName: cert.Subject.CommonName,
+			DNSNames:   cert.DNSNames,
+			Emails:     cert.EmailAddresses,
+		}
+		for _, uri := range cert.URIs {
+			id.URIs = append(id.URIs, uri.String())
+		}
+
+		ctx := context.WithValue(r.Context(), clientIdentityContextKey, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// LoadClientCAs reads the PEM-encoded CA bundle used to verify client certificates.
+func LoadClientCAs(file string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("reading client CA bundle: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificate found in client CA bundle %s", file)
+	}
+	return pool, nil
+}
+
+// ClientACL maps client identity names to the destinations they are allowed
+// to post to. Destinations are matched with path.Match patterns, such as
+// "slack/T00000000/*/*", and the "*" pattern allows every destination.
+type ClientACL map[string][]string
+
+// ParseClientACL parses an ACL in the form
+// "name=pattern,pattern;name=pattern", where name is the certificate subject,
+// common name or any of its SANs. The names containing "=", "," or ";", such
+// as the subjects, are written in double quotes, as in
+// `"CN=producer,O=Example"=slack/T00000000/*/*`, and a backslash in quotes
+// escapes the next character.
+func ParseClientACL(value string) (ClientACL, error) {
+	acl := make(ClientACL)
+	for rest := strings.TrimSpace(value); rest != ""; rest = strings.TrimSpace(rest) {
+		name, patterns, next, err := parseClientACLEntry(rest)
+		if err != nil {
+			return nil, err
+		}
+		rest = next
+		if name == "" && patterns == "" {
+			continue
+		}
+
+		if name == "" {
+			return nil, fmt.Errorf("invalid client ACL entry for %q, expected name=pattern[,pattern]", patterns)
+		}
+		for _, pattern := range strings.Split(patterns, ",") {
+			pattern = strings.TrimSpace(pattern)
+			if pattern == "" {
+				return nil, fmt.Errorf("empty client ACL pattern for %s", name)
+			}
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid client ACL pattern %q for %s: %w", pattern, name, err)
+			}
+			acl[name] = append(acl[name], pattern)
+		}
+	}
+
+	if len(acl) == 0 {
+		return nil, errors.New("empty client ACL")
+	}
+	return acl, nil
+}
+
+// parseClientACLEntry parses the first entry of value, and returns the rest
+// after its ";" separator.
+func parseClientACLEntry(value string) (name, patterns, rest string, err error) {
+	if strings.HasPrefix(value, ";") {
+		return "", "", value[1:], nil
+	}
+
+	if strings.HasPrefix(value, `"`) {
+		end := 1
+		for ; end < len(value) && value[end] != '"'; end++ {
+			if value[end] == '\\' {
+				end++
+			}
+		}
+		if end >= len(value) {
+			return "", "", "", fmt.Errorf("invalid client ACL name %s, missing closing quote", value)
+		}
+		name = value[1:end]
+		value = strings.TrimSpace(value[end+1:])
+		if !strings.HasPrefix(value, "=") {
+			return "", "", "", fmt.Errorf("invalid client ACL entry for %q, expected name=pattern[,pattern]", name)
+		}
+		patterns, rest, _ = strings.Cut(value[1:], ";")
+		return name, strings.TrimSpace(patterns), rest, nil
+	}
+
+	entry, rest, _ := strings.Cut(value, ";")
+	name, patterns, ok := strings.Cut(entry, "=")
+	if !ok || strings.TrimSpace(name) == "" {
+		return "", "", "", fmt.Errorf("invalid client ACL entry %q, expected name=pattern[,pattern]", strings.TrimSpace(entry))
+	}
+	return strings.TrimSpace(name), strings.TrimSpace(patterns), rest, nil
+}
+
+// Allowed reports whether the client is allowed to post to destination.
+func (acl ClientACL) Allowed(id *ClientIdentity, destination string) bool {
+	for _, name := range id.Names() {
+		for _, pattern := range acl[name] {
+			if ok, _ := path.Match(pattern, destination); ok || pattern == "*" {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,131 @@
+package http_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	appServer "github.com/dnsimple/strillone/internal/http"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// issueClientCert returns a client certificate for commonName and uri signed by a new CA.
+func issueClientCert(t *testing.T, commonName, uri string) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Strillone Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	ca, err := x509.ParseCertificate(caDER)
+	require.NoError(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	parsedURI, err := url.Parse(uri)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		URIs:         []*url.URL{parsedURI},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	require.NoError(t, err)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
+
+func TestClientACL(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	serverCert := writeSelfSignedCert(t, certFile, keyFile, "strillone", time.Now())
+	reloader, err := appServer.NewCertReloader(certFile, keyFile)
+	require.NoError(t, err)
+
+	clientCert, clientCAs := issueClientCert(t, "producer", "spiffe://example.com/producer")
+	acl, err := appServer.ParseClientACL("spiffe://example.com/producer=slack/-/allowed/*; other=*")
+	require.NoError(t, err)
+
+	tlsConfig := appServer.NewTLSConfig(reloader, tls.VersionTLS12, nil)
+	tlsConfig.ClientCAs = clientCAs
+	tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	baseURL := startTLSServer(t, tlsConfig, appServer.NewServer(appServer.WithClientACL(acl)))
+
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(serverCert)
+	post := func(certificates []tls.Certificate, path, requestID string) int {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: rootCAs, Certificates: certificates, MinVersion: tls.VersionTLS12}}}
+		defer client.CloseIdleConnections()
+
+		payload := `{"name": "domain.create", "request_identifier": "` + requestID + `", "data": {"domain": {"name": "example.com"}}}`
+		response, err := client.Post(baseURL+path, "application/json", strings.NewReader(payload))
+		require.NoError(t, err)
+		defer response.Body.Close()
+		return response.StatusCode
+	}
+
+	assert.Equal(t, http.StatusOK, post([]tls.Certificate{clientCert}, "/slack/-/allowed/channel", "b8a1f1a6-7c5e-4d61-a2f4-e1b2a1c3d001"))
+	assert.Equal(t, http.StatusForbidden, post([]tls.Certificate{clientCert}, "/slack/-/denied/channel", "b8a1f1a6-7c5e-4d61-a2f4-e1b2a1c3d002"))
+	// Clients without a certificate are not subject to the ACL.
+	assert.Equal(t, http.StatusOK, post(nil, "/slack/-/denied/channel", "b8a1f1a6-7c5e-4d61-a2f4-e1b2a1c3d003"))
+}
+
+func TestParseClientACL(t *testing.T) {
+	acl, err := appServer.ParseClientACL("producer=slack/T1/*/*,slack/T2/B2/*;ops.example.com=*")
+	require.NoError(t, err)
+
+	producer := &appServer.ClientIdentity{CommonName: "producer"}
+	assert.True(t, acl.Allowed(producer, "slack/T1/B1/C1"))
+	assert.True(t, acl.Allowed(producer, "slack/T2/B2/C2"))
+	assert.False(t, acl.Allowed(producer, "slack/T2/B3/C3"))
+	assert.True(t, acl.Allowed(&appServer.ClientIdentity{DNSNames: []string{"ops.example.com"}}, "slack/T9/B9/C9"))
+	assert.False(t, acl.Allowed(&appServer.ClientIdentity{CommonName: "unknown"}, "slack/T1/B1/C1"))
+
+	_, err = appServer.ParseClientACL("producer")
+	assert.Error(t, err)
+	_, err = appServer.ParseClientACL("producer=[")
+	assert.Error(t, err)
+	for _, value := range []string{"producer=", "producer=slack/T1/*/*,", `"CN=producer=slack/T1/*/*`, `"CN=producer"slack/T1/*/*`} {
+		_, err = appServer.ParseClientACL(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestParseClientACL_Subject(t *testing.T) {
+	acl, err := appServer.ParseClientACL(`"CN=producer,O=Example\, Inc."=slack/T1/*/*,slack/T2/*/*; ops.example.com=*`)
+	require.NoError(t, err)
+
+	producer := &appServer.ClientIdentity{Subject: `CN=producer,O=Example\, Inc.`, CommonName: "producer"}
+	assert.True(t, acl.Allowed(producer, "slack/T1/B1/C1"))
+	assert.True(t, acl.Allowed(producer, "slack/T2/B2/C2"))
+	assert.False(t, acl.Allowed(producer, "slack/T3/B3/C3"))
+	assert.False(t, acl.Allowed(&appServer.ClientIdentity{Subject: "CN=producer,O=Other"}, "slack/T1/B1/C1"))
+	assert.True(t, acl.Allowed(&appServer.ClientIdentity{DNSNames: []string{"ops.example.com"}}, "slack/T9/B9/C9"))
+}
@@ -0,0 +1,62 @@
+package http
+
+import (
+	"context"
+	"sync"
+)
+
+// keyedLocks serializes the synchronous deliveries of the events with the
+// same partition key, so that an event being retried is not overtaken by the
+// next event about the same domain.
+type keyedLocks struct {
+	mu    sync.Mutex
+	locks map[string]*keyedLock
+}
+
+type keyedLock struct {
+	// token is held by the delivery in progress. The blocked senders are
+	// woken up in order, so that the deliveries follow the arrival order.
+	token chan struct{}
+	refs  int
+}
+
+// lock waits for the deliveries in progress with key, and returns the
+// function releasing the lock. An empty key is not locked.
+func (k *keyedLocks) lock(ctx context.Context, key string) (func(), error) {
+	if key == "" {
+		return func() {}, nil
+	}
+
+	k.mu.Lock()
+	if k.locks == nil {
+		k.locks = make(map[string]*keyedLock)
+	}
+	l, ok := k.locks[key]
+	if !ok {
+		l = &keyedLock{token: make(chan struct{}, 1)}
+		k.locks[key] = l
+	}
+	l.refs++
+	k.mu.Unlock()
+
+	select {
+	case l.token <- struct{}{}:
+		return func() {
+			<-l.token
+			k.unref(key, l)
+		}, nil
+	case <-ctx.Done():
+		k.unref(key, l)
+		return nil, ctx.Err()
+	}
+}
+
+func (k *keyedLocks) unref(key string, l *keyedLock) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	l.refs--
+	if l.refs == 0 {
+		delete(k.locks, key)
+	}
+}
@@ -0,0 +1,243 @@
+package http
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// limiterIdleTTL is how long the limiter of an idle key is kept around.
+const limiterIdleTTL = 10 * time.Minute
+
+// RateLimit is a token bucket refilled at Rate tokens per second, holding up to Burst tokens.
+type RateLimit struct {
+	Rate  rate.Limit
+	Burst int
+}
+
+// ParseRateLimit parses a rate limit in the form "count/unit[:burst]", where
+// unit is one of s, m or h, such as "30/m" or "5/s:20". The burst defaults to
+// the count.
+func ParseRateLimit(value string) (RateLimit, error) {
+	spec, burstValue, hasBurst := strings.Cut(strings.TrimSpace(value), ":")
+	countValue, unit, ok := strings.Cut(spec, "/")
+	if !ok {
+		return RateLimit{}, fmt.Errorf("invalid rate limit %q, expected count/unit[:burst]", value)
+	}
+
+	count, err := strconv.Atoi(countValue)
+	if err != nil || count <= 0 {
+		return RateLimit{}, fmt.Errorf("invalid rate limit count in %q", value)
+	}
+
+	var per time.Duration
+	switch unit {
+	case "s":
+		per = time.Second
+	case "m":
+		per = time.Minute
+	case "h":
+		per = time.Hour
+	default:
+		return RateLimit{}, fmt.Errorf("invalid rate limit unit in %q, expected s, m or h", value)
+	}
+
+	burst := count
+	if hasBurst {
+		burst, err = strconv.Atoi(burstValue)
+		if err != nil || burst <= 0 {
+			return RateLimit{}, fmt.Errorf("invalid rate limit burst in %q", value)
+		}
+	}
+
+	return RateLimit{Rate: rate.Limit(float64(count) / per.Seconds()), Burst: burst}, nil
+}
+
+// RoutePolicy holds the rate limits of a route. A nil limit is not enforced.
+type RoutePolicy struct {
+	Client      *RateLimit
+	Destination *RateLimit
+}
+
+// ParseRateLimits parses the rate limits of the routes in the form
+// "route:client=limit,destination=limit;route:...", such as
+// "slack:client=5/s:20,destination=30/m". Only the slack route, whose path
+// holds the destination, has a destination limit.
+func ParseRateLimits(value string) (map[string]RoutePolicy, error) {
+	policies := make(map[string]RoutePolicy)
+	for _, entry := range strings.Split(value, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		route, limits, ok := strings.Cut(entry, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid rate limits %q, expected route:key=limit[,key=limit]", entry)
+		}
+		route = strings.TrimSpace(route)
+
+		var policy RoutePolicy
+		for _, limit := range strings.Split(limits, ",") {
+			key, spec, ok := strings.Cut(limit, "=")
+			if !ok {
+				return nil, fmt.Errorf("invalid rate limit %q for route %s", limit, route)
+			}
+			parsed, err := ParseRateLimit(spec)
+			if err != nil {
+				return nil, fmt.Errorf("route %s: %w", route, err)
+			}
+
+			switch strings.TrimSpace(key) {
+			case "client":
+				policy.Client = &parsed
+			case "destination":
+				if route != "slack" {
+					return nil, fmt.Errorf("invalid destination rate limit for route %s, only the slack route has one", route)
+				}
+				policy.Destination = &parsed
+			default:
+				return nil, fmt.Errorf("unknown rate limit key %q for route %s, expected client or destination", key, route)
+			}
+		}
+		policies[route] = policy
+	}
+	return policies, nil
+}
+
+// keyedLimiter keeps a token bucket per key, such as a client IP.
+type keyedLimiter struct {
+	limit RateLimit
+
+	mu        sync.Mutex
+	limiters  map[string]*keyedLimiterEntry
+	lastSweep time.Time
+}
+
+type keyedLimiterEntry struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+func newKeyedLimiter(limit RateLimit) *keyedLimiter {
+	return &keyedLimiter{limit: limit, limiters: make(map[string]*keyedLimiterEntry), lastSweep: time.Now()}
+}
+
+func (k *keyedLimiter) reserve(key string, now time.Time) *rate.Reservation {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if now.Sub(k.lastSweep) > limiterIdleTTL {
+		for key, entry := range k.limiters {
+			if now.Sub(entry.lastSeen) > limiterIdleTTL {
+				delete(k.limiters, key)
+			}
+		}
+		k.lastSweep = now
+	}
+
+	entry, ok := k.limiters[key]
+	if !ok {
+		entry = &keyedLimiterEntry{limiter: rate.NewLimiter(k.limit.Rate, k.limit.Burst)}
+		k.limiters[key] = entry
+	}
+	entry.lastSeen = now
+	return entry.limiter.ReserveN(now, 1)
+}
+
+// routeLimiter enforces a RoutePolicy.
+type routeLimiter struct {
+	client      *keyedLimiter
+	destination *keyedLimiter
+}
+
+func newRouteLimiter(policy RoutePolicy) *routeLimiter {
+	l := &routeLimiter{}
+	if policy.Client != nil {
+		l.client = newKeyedLimiter(*policy.Client)
+	}
+	if policy.Destination != nil {
+		l.destination = newKeyedLimiter(*policy.Destination)
+	}
+	return l
+}
+
+// allow consumes a token from both buckets, and returns how long to wait
+// before retrying when either is empty. Tokens are only consumed when both
+// buckets allow the request.
+func (l *routeLimiter) allow(client, destination string) (bool, time.Duration) {
+	now := time.Now()
+
+	var reservations []*rate.Reservation
+	if l.client != nil {
+		reservations = append(reservations, l.client.reserve(client, now))
+	}
+	if l.destination != nil && destination != "" {
+		reservations = append(reservations, l.destination.reserve(destination, now))
+	}
+
+	var wait time.Duration
+	for _, r := range reservations {
+		if !r.OK() {
+			wait = max(wait, time.Minute)
+			continue
+		}
+		wait = max(wait, r.DelayFrom(now))
+	}
+	if wait == 0 {
+		return true, 0
+	}
+
+	for _, r := range reservations {
+		r.CancelAt(now)
+	}
+	return false, wait
+}
+
+// rateLimited wraps a route handler with the limits configured for route, if any.
+func (s *Server) rateLimited(route string, destination func(*http.Request) string, next http.HandlerFunc) http.Handler {
+	policy, ok := s.rateLimits[route]
+	if !ok {
+		return next
+	}
+
+	limiter := newRouteLimiter(policy)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client := s.clientIP(r)
+		allowed, wait := limiter.allow(client, destination(r))
+		if !allowed {
+			log.Printf("[request:%s] Rate limit exceeded for client %s on route %s\n", RequestID(r), client, route)
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+			return
+		}
+
+		next(w, r)
+	})
+}
+
+// clientIP returns the IP of the client. Behind a trusted proxy, such as the
+// Heroku router, the client IP is the last one appended to X-Forwarded-For,
+// as the previous ones are controlled by the client.
+func (s *Server) clientIP(r *http.Request) string {
+	if s.trustProxy {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			ips := strings.Split(forwarded, ",")
+			return strings.TrimSpace(ips[len(ips)-1])
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
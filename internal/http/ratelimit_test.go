@@ -0,0 +1,76 @@
+package http_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	appServer "github.com/dnsimple/strillone/internal/http"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	limit, err := appServer.ParseRateLimit("30/m")
+	require.NoError(t, err)
+	assert.Equal(t, appServer.RateLimit{Rate: rate.Limit(0.5), Burst: 30}, limit)
+
+	limit, err = appServer.ParseRateLimit("5/s:20")
+	require.NoError(t, err)
+	assert.Equal(t, appServer.RateLimit{Rate: rate.Limit(5), Burst: 20}, limit)
+
+	for _, invalid := range []string{"", "5", "0/s", "5/d", "5/s:0", "x/s"} {
+		_, err := appServer.ParseRateLimit(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestParseRateLimits(t *testing.T) {
+	policies, err := appServer.ParseRateLimits("slack:client=5/s:20,destination=30/m; root:client=1/s")
+	require.NoError(t, err)
+	assert.Equal(t, rate.Limit(5), policies["slack"].Client.Rate)
+	assert.Equal(t, 30, policies["slack"].Destination.Burst)
+	assert.Nil(t, policies["root"].Destination)
+
+	_, err = appServer.ParseRateLimits("slack:sender=5/s")
+	assert.Error(t, err)
+
+	_, err = appServer.ParseRateLimits("events:destination=30/m")
+	assert.Error(t, err)
+}
+
+func TestRateLimits(t *testing.T) {
+	policies, err := appServer.ParseRateLimits("slack:client=1/h:3,destination=1/h:2")
+	require.NoError(t, err)
+	limitedServer := appServer.NewServer(appServer.WithRateLimits(policies), appServer.WithTrustedProxy())
+
+	post := func(clientIP, path, requestID string) *httptest.ResponseRecorder {
+		payload := `{"name": "domain.create", "request_identifier": "` + requestID + `", "data": {"domain": {"name": "example.com"}}}`
+		request, _ := http.NewRequest("POST", path, strings.NewReader(payload))
+		request.Header.Set("X-Forwarded-For", "203.0.113.1, "+clientIP)
+		response := httptest.NewRecorder()
+		limitedServer.ServeHTTP(response, request)
+		return response
+	}
+
+	// The destination allows 2 requests.
+	assert.Equal(t, http.StatusOK, post("198.51.100.1", "/slack/-/a/a", "c1").Code)
+	assert.Equal(t, http.StatusOK, post("198.51.100.2", "/slack/-/a/a", "c2").Code)
+	response := post("198.51.100.3", "/slack/-/a/a", "c3")
+	assert.Equal(t, http.StatusTooManyRequests, response.Code)
+	assert.Equal(t, "3600", response.Header().Get("Retry-After"))
+
+	// The client allows 3 requests, and the rejected request above didn't consume any token.
+	assert.Equal(t, http.StatusOK, post("198.51.100.3", "/slack/-/b/b", "c4").Code)
+	assert.Equal(t, http.StatusOK, post("198.51.100.3", "/slack/-/c/c", "c5").Code)
+	assert.Equal(t, http.StatusOK, post("198.51.100.3", "/slack/-/d/d", "c6").Code)
+	assert.Equal(t, http.StatusTooManyRequests, post("198.51.100.3", "/slack/-/e/e", "c7").Code)
+
+	// Routes without limits are not affected.
+	request, _ := http.NewRequest("GET", "/", nil)
+	rootResponse := httptest.NewRecorder()
+	limitedServer.ServeHTTP(rootResponse, request)
+	assert.Equal(t, http.StatusOK, rootResponse.Code)
+}
@@ -1,47 +1,250 @@
 package http
 
 import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/dnsimple/dnsimple-go/v7/dnsimple/webhook"
+	"github.com/dnsimple/strillone/internal/breaker"
 	"github.com/dnsimple/strillone/internal/config"
+	"github.com/dnsimple/strillone/internal/dedup"
+	"github.com/dnsimple/strillone/internal/dlq"
+	"github.com/dnsimple/strillone/internal/outbox"
+	"github.com/dnsimple/strillone/internal/replay"
+	"github.com/dnsimple/strillone/internal/routing"
+	"github.com/dnsimple/strillone/internal/schedule"
 	"github.com/dnsimple/strillone/internal/service"
-	"github.com/wunderlist/ttlcache"
+	"github.com/dnsimple/strillone/internal/throttle"
 )
 
 const (
 	cacheTTL               = 300
+	inFlightPollInterval   = 50 * time.Millisecond
 	HeaderProcessingStatus = "X-Processing-Status"
 )
 
+// DedupStore remembers which webhook events were already processed.
+//
+// An event is claimed before being processed, so that concurrent deliveries
+// of the same event are not published twice, and the claim is then either
+// committed with Mark or released on failure.
+type DedupStore interface {
+	// Claim atomically claims the event with the given request ID, unless it
+	// is already in flight or processed.
+	Claim(requestID string) (dedup.Status, error)
+	// Mark records the event with the given request ID as processed.
+	Mark(requestID string) error
+	// Release releases a claim that wasn't committed.
+	Release(requestID string) error
+	// Close releases the resources held by the store.
+	Close() error
+}
+
+// Outbox persists the events to be delivered asynchronously.
+type Outbox interface {
+	// Enqueue durably stores the event to be delivered to each of
+	// deliveries, all or none.
+	Enqueue(requestID string, payload []byte, deliveries ...outbox.Delivery) error
+}
+
 // Server represents a front-end web server.
 type Server struct {
 	mux          *http.ServeMux
-	webhookCache *ttlcache.Cache
+	handler      http.Handler
+	webhookCache DedupStore
+	inFlightWait time.Duration
+	replayGuard  *replay.Guard
+	outbox       Outbox
+	policy       service.DeliveryPolicy
+	deadLetters  *dlq.Queue
+	breakers     *breaker.Breakers
+	routes       *routing.Config
+	reloader     *routing.Reloader
+	throttle     *throttle.Throttle
+	schedule     *schedule.Store
+	ordering     keyedLocks
+	adminToken   string
+	clientACL    ClientACL
+	rateLimits   map[string]RoutePolicy
+	trustProxy   bool
 }
 
-// NewServer returns a new front-end web server that handles HTTP requests for the app.
-func NewServer() *Server {
-	cache := ttlcache.NewCache(cacheTTL * time.Second)
+// Option configures optional Server features.
+type Option func(*Server)
+
+// WithDedupStore replaces the in-memory store of the processed events.
+func WithDedupStore(store DedupStore) Option {
+	return func(s *Server) {
+		s.webhookCache = store
+	}
+}
+
+// WithInFlightWait makes concurrent deliveries of an event wait up to d for
+// the first delivery to complete, instead of being skipped right away.
+func WithInFlightWait(d time.Duration) Option {
+	return func(s *Server) {
+		s.inFlightWait = d
+	}
+}
+
+// WithDeliveryPolicy retries the synchronous deliveries according to policy.
+func WithDeliveryPolicy(policy service.DeliveryPolicy) Option {
+	return func(s *Server) {
+		s.policy = policy
+	}
+}
+
+// WithOutbox accepts the events with a 202 once persisted in outbox, instead
+// of delivering them while the webhook request waits.
+func WithOutbox(outbox Outbox) Option {
+	return func(s *Server) {
+		s.outbox = outbox
+	}
+}
+
+// WithDeadLetterQueue moves the events that could not be delivered to
+// queue, instead of failing the webhook request.
+func WithDeadLetterQueue(queue *dlq.Queue) Option {
+	return func(s *Server) {
+		s.deadLetters = queue
+	}
+}
+
+// WithBreakers stops delivering to the destinations with an open circuit.
+func WithBreakers(breakers *breaker.Breakers) Option {
+	return func(s *Server) {
+		s.breakers = breakers
+	}
+}
+
+// WithRoutes publishes the events posted to /events/{token} to the
+// destinations of the routes matching them.
+func WithRoutes(routes *routing.Config) Option {
+	return func(s *Server) {
+		s.routes = routes
+	}
+}
+
+// WithRoutingReloader is like WithRoutes, with the configuration of reloader
+// as last reloaded.
+func WithRoutingReloader(reloader *routing.Reloader) Option {
+	return func(s *Server) {
+		s.reloader = reloader
+	}
+}
+
+// WithThrottle counts the events of the capped and sampled routes in
+// throttle, which summarizes the dropped events.
+func WithThrottle(throttle *throttle.Throttle) Option {
+	return func(s *Server) {
+		s.throttle = throttle
+	}
+}
+
+// WithSchedule applies the maintenance windows of store, and defers the
+// events into its digests.
+func WithSchedule(store *schedule.Store) Option {
+	return func(s *Server) {
+		s.schedule = store
+	}
+}
+
+// WithAdminToken enables the admin API, authenticated with the bearer token.
+func WithAdminToken(token string) Option {
+	return func(s *Server) {
+		s.adminToken = token
+	}
+}
+
+// WithReplayGuard rejects stale events and events already seen by guard.
+func WithReplayGuard(guard *replay.Guard) Option {
+	return func(s *Server) {
+		s.replayGuard = guard
+	}
+}
+
+// WithClientACL restricts the destinations clients authenticated with a TLS
+// client certificate can post to. Requests without a certificate are not affected.
+func WithClientACL(acl ClientACL) Option {
+	return func(s *Server) {
+		s.clientACL = acl
+	}
+}
+
+// WithRateLimits limits the requests to the routes by client IP and by
+// destination. The only route with a destination is "slack".
+func WithRateLimits(policies map[string]RoutePolicy) Option {
+	return func(s *Server) {
+		s.rateLimits = policies
+	}
+}
+
+// WithTrustedProxy takes the client IP from the X-Forwarded-For header.
+func WithTrustedProxy() Option {
+	return func(s *Server) {
+		s.trustProxy = true
+	}
+}
 
+// NewServer returns a new front-end web server that handles HTTP requests for the app.
+func NewServer(opts ...Option) *Server {
 	mux := http.NewServeMux()
 	server := &Server{
-		mux:          mux,
-		webhookCache: cache,
+		mux: mux,
+	}
+	for _, opt := range opts {
+		opt(server)
+	}
+	if server.webhookCache == nil {
+		server.webhookCache = dedup.NewMemoryStore(cacheTTL * time.Second)
+	}
+	if server.throttle == nil {
+		server.throttle = throttle.New()
 	}
 
-	mux.Handle("GET /", http.HandlerFunc(server.Root))
-	mux.Handle("POST /slack/{slackAlpha}/{slackBeta}/{slackGamma}", http.HandlerFunc(server.Slack))
+	mux.Handle("GET /", server.rateLimited("root", noDestination, server.Root))
+	mux.Handle("POST /slack/{slackAlpha}/{slackBeta}/{slackGamma}", server.rateLimited("slack", slackDestination, server.Slack))
+	if server.routes != nil || server.reloader != nil {
+		mux.Handle("POST /events/{token}", server.rateLimited("events", noDestination, server.Events))
+	}
+	if server.adminToken != "" {
+		mux.Handle("GET /admin/metrics", server.rateLimited("admin", noDestination, server.admin(server.Metrics)))
+	}
+	if server.adminToken != "" && server.deadLetters != nil {
+		mux.Handle("GET /admin/dlq", server.rateLimited("admin", noDestination, server.admin(server.ListDeadLetters)))
+		mux.Handle("POST /admin/dlq/{id}/redrive", server.rateLimited("admin", noDestination, server.admin(server.RedriveDeadLetter)))
+		mux.Handle("DELETE /admin/dlq/{id}", server.rateLimited("admin", noDestination, server.admin(server.DeleteDeadLetter)))
+	}
+	if server.adminToken != "" && server.schedule != nil {
+		mux.Handle("GET /admin/windows", server.rateLimited("admin", noDestination, server.admin(server.ListWindows)))
+		mux.Handle("POST /admin/windows", server.rateLimited("admin", noDestination, server.admin(server.CreateWindow)))
+		mux.Handle("DELETE /admin/windows/{id}", server.rateLimited("admin", noDestination, server.admin(server.DeleteWindow)))
+	}
+	if server.adminToken != "" && server.breakers != nil {
+		mux.Handle("GET /admin/breakers", server.rateLimited("admin", noDestination, server.admin(server.ListBreakers)))
+	}
+	if server.adminToken != "" && server.reloader != nil {
+		mux.Handle("GET /admin/routing", server.rateLimited("admin", noDestination, server.admin(server.RoutingStatus)))
+		mux.Handle("POST /admin/routing/reload", server.rateLimited("admin", noDestination, server.admin(server.ReloadRouting)))
+	}
+
+	server.handler = WithRequestID(Recover(WithClientIdentity(mux)))
 	return server
 }
 
 // ServeHTTP implements http.Handler.
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	s.mux.ServeHTTP(w, r)
+	s.handler.ServeHTTP(w, r)
 }
 
 // Root is the handler for the HTTP requests to /.
@@ -62,6 +265,306 @@ func (s *Server) Slack(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	filter, err := routing.ParseFilter(r.URL.Query()["include"], r.URL.Query()["exclude"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		log.Printf("Error parsing filter: %v\n", err)
+		return
+	}
+
+	destination := slackDestination(r)
+	routes := s.currentRoutes()
+	s.publish(w, r, func(event *webhook.Event, _ bool) ([]delivery, string) {
+		if !filter.Allows(event.Name) {
+			return nil, "skipped;filtered"
+		}
+		// The account of an unauthenticated request can't select the rules
+		// of a tenant, only the look of its messages.
+		deliveries, skipped := applyActorRule(routes, event, []delivery{{destination: destination}}, false)
+		deliveries = applyFreeze(routes, event, deliveries, false)
+		return applyStyle(routes.For(event), event, deliveries), skipped
+	})
+}
+
+// Events handles a request to publish a webhook to the destinations of the
+// routes matching the event.
+func (s *Server) Events(w http.ResponseWriter, r *http.Request) {
+	// The token is a secret, and is not logged.
+	log.Printf("%s /events/…\n", r.Method)
+
+	token := r.PathValue("token")
+	routes := s.currentRoutes()
+	if routes == nil || !slices.ContainsFunc(routes.Tokens(), func(t string) bool { return validToken(token, t) }) {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.publish(w, r, func(event *webhook.Event, throttled bool) ([]delivery, string) {
+		// The events of a tenant are only accepted with its token, so that
+		// a tenant can't publish to the destinations of another.
+		routes := routes.For(event)
+		if !validToken(token, routes.Token) {
+			return nil, "rejected;tenant"
+		}
+
+		var allow func(*routing.Route) bool
+		if throttled {
+			allow = s.allowRoute(event)
+		}
+		matched, dropped := routes.ResolveWith(event, allow)
+		deliveries, skipped := applyActorRule(routes, event, allowedDeliveries(event, matched), true)
+		if throttled && skipped == "" {
+			s.recordDropped(event, dropped)
+		}
+		deliveries = applyFreeze(routes, event, deliveries, true)
+		deliveries = applyStyle(routes, event, deliveries)
+		switch {
+		case skipped != "" || len(deliveries) > 0:
+			return deliveries, skipped
+		case len(matched) == 0 && len(dropped) > 0:
+			return nil, "skipped;throttled"
+		case len(matched) == 0:
+			return nil, "skipped;unrouted"
+		default:
+			return nil, "skipped;filtered"
+		}
+	})
+}
+
+// allowRoute returns whether the caps and the sampling of a route let the
+// event through.
+func (s *Server) allowRoute(event *webhook.Event) func(*routing.Route) bool {
+	now := time.Now()
+	return func(route *routing.Route) bool {
+		limits := route.Limits()
+		return limits.IsZero() || s.throttle.Allow(route.Key(), event.Name, limits, now)
+	}
+}
+
+// recordDropped counts the event for the summaries of the destinations it
+// was dropped from by the caps and the sampling of the routes.
+func (s *Server) recordDropped(event *webhook.Event, dropped []*routing.Destination) {
+	for _, destination := range dropped {
+		if !destination.Allows(event.Name) {
+			continue
+		}
+		log.Printf("[event:%v] Throttled for %s\n", event.RequestID, service.RedactDestination(destination.Target()))
+		s.throttle.Record(throttle.Drop{
+			Destination: destination.Target(),
+			Event:       event.Name,
+			Domain:      strings.ToLower(service.DomainName(event)),
+		})
+	}
+}
+
+// currentRoutes returns the routing configuration, as last reloaded. The
+// requests use the configuration active when they start.
+func (s *Server) currentRoutes() *routing.Config {
+	if s.reloader != nil {
+		return s.reloader.Config()
+	}
+	return s.routes
+}
+
+// delivery is a destination of an event, and how the event is presented there.
+type delivery struct {
+	destination string
+	style       service.Style
+	// name and quietHours are only set for the named destinations.
+	name       string
+	quietHours []*schedule.QuietHours
+}
+
+// allowedDeliveries returns the deliveries to the destinations whose filter
+// allows the event.
+func allowedDeliveries(event *webhook.Event, destinations []*routing.Destination) []delivery {
+	var deliveries []delivery
+	for _, destination := range destinations {
+		if destination.Allows(event.Name) {
+			deliveries = append(deliveries, delivery{
+				destination: destination.Target(),
+				name:        destination.Name,
+				quietHours:  destination.QuietHours,
+			})
+		}
+	}
+	return deliveries
+}
+
+// applyActorRule mutes, downgrades or redirects the deliveries of the event
+// according to the rule of its actor, if any. The redirect rules are ignored
+// unless redirect is true.
+func applyActorRule(routes *routing.Config, event *webhook.Event, deliveries []delivery, redirect bool) ([]delivery, string) {
+	if routes == nil {
+		return deliveries, ""
+	}
+	rule := routes.MatchActor(event)
+	if rule == nil {
+		return deliveries, ""
+	}
+	if rule.Action == routing.ActionRedirect && !redirect {
+		// The actor of an unauthenticated request can't choose its
+		// destinations.
+		log.Printf("[event:%v] Ignoring the redirect rule %q on a Slack URL\n", event.RequestID, rule.Name)
+		return deliveries, ""
+	}
+
+	log.Printf("[event:%v] Actor rule %q of %s: %s\n", event.RequestID, rule.Name, event.Actor.Pretty, rule.Action)
+	switch rule.Action {
+	case routing.ActionMute:
+		return nil, "skipped;muted"
+	case routing.ActionRedirect:
+		deliveries = allowedDeliveries(event, rule.Redirect())
+		if len(deliveries) == 0 {
+			return nil, "skipped;filtered"
+		}
+	}
+
+	for i := range deliveries {
+		deliveries[i].style = rule.Style()
+	}
+	return deliveries, ""
+}
+
+// applyFreeze escalates the deliveries of the event during the first active
+// change freeze it matches, and adds the incident destinations of the freeze
+// if incidents is true. The skipped events are not escalated.
+func applyFreeze(routes *routing.Config, event *webhook.Event, deliveries []delivery, incidents bool) []delivery {
+	if routes == nil || len(deliveries) == 0 {
+		return deliveries
+	}
+	freezes := routes.ActiveFreezes(event, time.Now())
+	if len(freezes) == 0 {
+		return deliveries
+	}
+
+	freeze := freezes[0]
+	log.Printf("[event:%v] Escalated during the %q freeze\n", event.RequestID, freeze.Name)
+	if incidents {
+		for _, incident := range freeze.Incidents() {
+			if !slices.ContainsFunc(deliveries, func(d delivery) bool { return d.destination == incident.Target() }) {
+				deliveries = append(deliveries, delivery{destination: incident.Target(), name: incident.Name})
+			}
+		}
+	}
+
+	style := service.Style{Freeze: freeze.Name, Mentions: freeze.Mentions}
+	for i := range deliveries {
+		deliveries[i].style = style
+	}
+	return deliveries
+}
+
+// applyStyle sets the template and the DNSimple URL of the configuration of
+// the event on the deliveries.
+func applyStyle(routes *routing.Config, event *webhook.Event, deliveries []delivery) []delivery {
+	if routes == nil {
+		return deliveries
+	}
+	style := routes.Style(event)
+	for i := range deliveries {
+		deliveries[i].style.DNSimpleURL = style.DNSimpleURL
+		deliveries[i].style.Template = style.Template
+	}
+	return deliveries
+}
+
+// validToken compares the token of a request path with an expected token in
+// constant time. An empty token is never valid.
+func validToken(token, expected string) bool {
+	return expected != "" && subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1
+}
+
+// applySchedule suppresses, defers into a digest or silences the deliveries
+// during the quiet hours and maintenance windows of their destinations, and
+// reports whether some were deferred.
+func (s *Server) applySchedule(event *webhook.Event, deliveries []delivery) ([]delivery, bool) {
+	now := time.Now()
+	kept := deliveries[:0]
+	deferred := false
+	for _, delivery := range deliveries {
+		// The events escalated during a change freeze are never held back.
+		var period *schedule.Period
+		if delivery.style.Freeze == "" {
+			period = s.activePeriod(now, delivery)
+		}
+		if period == nil {
+			kept = append(kept, delivery)
+			continue
+		}
+
+		if period.Mode == schedule.Suppress {
+			log.Printf("[event:%v] Suppressed for %s during %s\n", event.RequestID, service.RedactDestination(delivery.destination), period.Label)
+			continue
+		}
+		if period.Mode == schedule.Digest && s.deferDelivery(event, delivery, period) {
+			deferred = true
+			continue
+		}
+		// Deliver silently rather than lose the events that could not be deferred.
+		delivery.style.Quiet = true
+		kept = append(kept, delivery)
+	}
+	return kept, deferred
+}
+
+// activePeriod returns the strictest quiet hours or maintenance window of
+// the delivery active at now, or nil.
+func (s *Server) activePeriod(now time.Time, delivery delivery) *schedule.Period {
+	var periods []*schedule.Period
+	for _, quietHours := range delivery.quietHours {
+		if period := quietHours.Active(now); period != nil {
+			periods = append(periods, period)
+		}
+	}
+
+	if s.schedule != nil {
+		windows, err := s.schedule.Active(now, delivery.name, delivery.destination)
+		if err != nil {
+			log.Printf("Error reading maintenance windows: %v\n", err)
+		}
+		periods = append(periods, windows...)
+	}
+	return schedule.Strictest(periods)
+}
+
+// deferDelivery adds the event to the digest of the delivery posted at the
+// end of period, and reports whether it was stored.
+func (s *Server) deferDelivery(event *webhook.Event, delivery delivery, period *schedule.Period) bool {
+	if s.schedule == nil {
+		return false
+	}
+	messaging, err := service.NewMessagingService(delivery.destination, delivery.style)
+	if err != nil {
+		log.Printf("[event:%v] Error deferring event: %v\n", event.RequestID, err)
+		return false
+	}
+
+	err = s.schedule.Defer(schedule.DigestItem{
+		Destination: delivery.destination,
+		Label:       period.Label,
+		Due:         period.End,
+		Text:        delivery.style.Message(messaging, event),
+	})
+	if err != nil {
+		log.Printf("[event:%v] Error deferring event: %v\n", event.RequestID, err)
+		return false
+	}
+
+	log.Printf("[event:%v] Deferred for %s into the digest of %s\n", event.RequestID, service.RedactDestination(delivery.destination), period.Label)
+	return true
+}
+
+// publish publishes the event in the request body to the deliveries
+// returned by resolve, or skips it with the processing status returned
+// when there are none. The events resolved with a "rejected;" status are
+// refused with a 403.
+//
+// The event is resolved twice: first without the caps and the sampling of
+// the routes, to check the request, then with them once the event is claimed
+// and not replayed, so that the retries, the duplicates and the refused
+// requests don't count against the caps nor in the throttle summaries.
+func (s *Server) publish(w http.ResponseWriter, r *http.Request, resolve func(event *webhook.Event, throttled bool) ([]delivery, string)) {
 	data, err := io.ReadAll(r.Body)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -76,29 +579,299 @@ func (s *Server) Slack(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check if the event was already processed
-	_, cacheExists := s.webhookCache.Get(event.RequestID)
-	if cacheExists {
+	deliveries, skipped := resolve(event, false)
+	if strings.HasPrefix(skipped, "rejected;") {
+		log.Printf("Rejecting event %v: %s\n", event.RequestID, skipped)
+		w.Header().Set(HeaderProcessingStatus, skipped)
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	if identity, ok := ClientIdentityFromRequest(r); ok {
+		log.Printf("Request from client %s\n", identity)
+		for _, delivery := range deliveries {
+			if s.clientACL != nil && !s.clientACL.Allowed(identity, delivery.destination) {
+				log.Printf("Client %s is not allowed to post to %s\n", identity, service.RedactDestination(delivery.destination))
+				http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+				return
+			}
+		}
+	}
+
+	// Check if the event was already processed, or is being processed
+	status, err := s.claim(event.RequestID)
+	switch {
+	case err != nil:
+		// Publishing a duplicate is better than losing the event.
+		log.Printf("Error claiming event %v: %v\n", event.RequestID, err)
+	case status == dedup.Processed:
 		log.Printf("Skipping event %v as already processed\n", event.RequestID)
 		w.Header().Set(HeaderProcessingStatus, "skipped;already-processed")
 		w.WriteHeader(http.StatusOK)
 		return
+	case status == dedup.InFlight:
+		// The sender retries later in case the delivery in flight fails.
+		log.Printf("Skipping event %v as in flight\n", event.RequestID)
+		w.Header().Set(HeaderProcessingStatus, "skipped;in-flight")
+		w.WriteHeader(http.StatusConflict)
+		return
 	}
 
-	slackAlpha := r.PathValue("slackAlpha")
-	slackBeta := r.PathValue("slackBeta")
-	slackGamma := r.PathValue("slackGamma")
-	slackToken := fmt.Sprintf("%s/%s/%s", slackAlpha, slackBeta, slackGamma)
+	committed := false
+	if status == dedup.Claimed {
+		defer func() {
+			if committed {
+				return
+			}
+			if err := s.webhookCache.Release(event.RequestID); err != nil {
+				log.Printf("Error releasing event %v: %v\n", event.RequestID, err)
+			}
+		}()
+	}
 
-	service := &service.SlackService{Token: slackToken}
-	text, err := service.PostEvent(event)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		log.Printf("Internal Error: %v\n", err)
+	if s.replayGuard != nil {
+		switch err := s.replayGuard.Check(event); {
+		case errors.Is(err, replay.ErrStale):
+			log.Printf("Rejecting event %v: %v\n", event.RequestID, err)
+			w.Header().Set(HeaderProcessingStatus, "rejected;stale")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		case errors.Is(err, replay.ErrReplayed):
+			log.Printf("Skipping event %v as already seen\n", event.RequestID)
+			w.Header().Set(HeaderProcessingStatus, "skipped;replayed")
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+	}
+
+	deliveries, skipped = resolve(event, true)
+	if len(deliveries) == 0 {
+		log.Printf("Skipping event %v: %s\n", event.RequestID, skipped)
+		s.commit(event)
+		committed = true
+		w.Header().Set(HeaderProcessingStatus, skipped)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	deliveries, deferred := s.applySchedule(event, deliveries)
+	if len(deliveries) == 0 {
+		s.commit(event)
+		committed = true
+		if deferred {
+			w.Header().Set(HeaderProcessingStatus, "deferred")
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		w.Header().Set(HeaderProcessingStatus, "skipped;suppressed")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if s.outbox != nil {
+		queued := make([]outbox.Delivery, 0, len(deliveries))
+		for _, delivery := range deliveries {
+			queued = append(queued, outbox.Delivery{Destination: delivery.destination, Style: delivery.style})
+		}
+		if err := s.outbox.Enqueue(event.RequestID, data, queued...); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			log.Printf("Error queuing event %v: %v\n", event.RequestID, err)
+			return
+		}
+
+		s.commit(event)
+		committed = true
+		w.Header().Set(HeaderProcessingStatus, "queued")
+		w.WriteHeader(http.StatusAccepted)
 		return
 	}
 
-	s.webhookCache.Set(event.RequestID, "1")
+	// When a destination fails, the sender retries the event, so the
+	// destinations completed before are recorded to be skipped then.
+	track := len(deliveries) > 1
+	var texts []string
+	deadLettered := false
+	for _, delivery := range deliveries {
+		done := deliveryKey(event.RequestID, delivery.destination)
+		if track && !s.claimDelivery(event, delivery, done) {
+			continue
+		}
+
+		key := service.PartitionKey(event)
+		if key != "" {
+			key = delivery.destination + " " + key
+		}
+		unlock, err := s.ordering.lock(r.Context(), key)
+		if err != nil {
+			if track {
+				s.releaseDelivery(done)
+			}
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			log.Printf("Error waiting for the previous events of %v: %v\n", event.RequestID, err)
+			return
+		}
+
+		text, err := s.post(r.Context(), delivery.destination, delivery.style, event)
+		unlock()
+		if err != nil && s.deadLetter(event, delivery, data, err) {
+			if track {
+				s.markDelivery(done)
+			}
+			deadLettered = true
+			continue
+		}
+		if err != nil && track {
+			s.releaseDelivery(done)
+		}
+		if errors.Is(err, breaker.ErrOpen) {
+			// The sender retries later, hopefully once the circuit is closed.
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			log.Printf("Skipping event %v: %v\n", event.RequestID, err)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			log.Printf("Internal Error: %v\n", err)
+			return
+		}
+		if track {
+			s.markDelivery(done)
+		}
+		texts = append(texts, text)
+	}
+
+	s.commit(event)
+	committed = true
+	if deadLettered {
+		w.Header().Set(HeaderProcessingStatus, "dead-lettered")
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	for _, text := range texts {
+		fmt.Fprintln(w, text)
+	}
+}
+
+// post delivers the event to destination in style, according to the
+// delivery policy.
+func (s *Server) post(ctx context.Context, destination string, style service.Style, event *webhook.Event) (string, error) {
+	messaging, err := service.NewMessagingService(destination, style)
+	if err != nil {
+		return "", err
+	}
+
+	if s.breakers != nil {
+		messaging = s.breakers.Wrap(destination, messaging)
+	}
+	return s.policy.Post(ctx, messaging, event)
+}
+
+// deadLetter moves an event that could not be delivered to the dead-letter
+// queue, and reports whether it was stored.
+func (s *Server) deadLetter(event *webhook.Event, delivery delivery, payload []byte, err error) bool {
+	if s.deadLetters == nil {
+		return false
+	}
+
+	entry, addErr := s.deadLetters.Add(dlq.Entry{
+		RequestID:   event.RequestID,
+		Destination: delivery.destination,
+		Style:       delivery.style,
+		Payload:     payload,
+		Attempts:    attempts(err),
+		LastError:   err.Error(),
+	})
+	if addErr != nil {
+		log.Printf("Error moving event %v to the dead-letter queue: %v\n", event.RequestID, addErr)
+		return false
+	}
+
+	log.Printf("[event:%v] Moved to the dead-letter queue as %d: %v\n", event.RequestID, entry.ID, err)
+	return true
+}
+
+// attempts returns the number of delivery attempts that ended with err.
+func attempts(err error) int {
+	if errors.Is(err, breaker.ErrOpen) {
+		return 0
+	}
+	var deliveryErr *service.DeliveryError
+	if errors.As(err, &deliveryErr) {
+		return deliveryErr.Attempts
+	}
+	return 1
+}
+
+// commit records the event as processed once published or queued. Errors
+// are only logged, as the event was already handled.
+func (s *Server) commit(event *webhook.Event) {
+	if err := s.webhookCache.Mark(event.RequestID); err != nil {
+		log.Printf("Error marking event %v as processed: %v\n", event.RequestID, err)
+	}
+
+	if s.replayGuard != nil {
+		s.replayGuard.Record(event.RequestID)
+	}
+}
+
+// deliveryKey identifies the delivery of an event to a destination in the
+// dedup store, without storing the secret destination.
+func deliveryKey(requestID, destination string) string {
+	sum := sha256.Sum256([]byte(destination))
+	return requestID + "/" + hex.EncodeToString(sum[:8])
+}
+
+// claimDelivery reports whether the event is to be delivered to the
+// destination, that is unless it was delivered by a previous attempt.
+func (s *Server) claimDelivery(event *webhook.Event, delivery delivery, key string) bool {
+	status, err := s.webhookCache.Claim(key)
+	if err != nil {
+		// Publishing a duplicate is better than losing the event.
+		log.Printf("[event:%v] Error claiming delivery to %s: %v\n", event.RequestID, service.RedactDestination(delivery.destination), err)
+		return true
+	}
+	if status != dedup.Claimed {
+		log.Printf("[event:%v] Skipping %s as already delivered\n", event.RequestID, service.RedactDestination(delivery.destination))
+		return false
+	}
+	return true
+}
+
+func (s *Server) markDelivery(key string) {
+	if err := s.webhookCache.Mark(key); err != nil {
+		log.Printf("Error marking delivery %v as processed: %v\n", key, err)
+	}
+}
+
+func (s *Server) releaseDelivery(key string) {
+	if err := s.webhookCache.Release(key); err != nil {
+		log.Printf("Error releasing delivery %v: %v\n", key, err)
+	}
+}
+
+// claim claims the event, waiting up to inFlightWait for a concurrent
+// delivery of the same event to complete.
+func (s *Server) claim(requestID string) (dedup.Status, error) {
+	deadline := time.Now().Add(s.inFlightWait)
+	for {
+		status, err := s.webhookCache.Claim(requestID)
+		if err != nil || status != dedup.InFlight || time.Now().After(deadline) {
+			return status, err
+		}
+		time.Sleep(inFlightPollInterval)
+	}
+}
+
+func slackToken(r *http.Request) string {
+	return fmt.Sprintf("%s/%s/%s", r.PathValue("slackAlpha"), r.PathValue("slackBeta"), r.PathValue("slackGamma"))
+}
+
+// slackDestination returns the name of the Slack destination of the request,
+// as used in the client ACL and the rate limits.
+func slackDestination(r *http.Request) string {
+	return "slack/" + slackToken(r)
+}
 
-	fmt.Fprintln(w, text)
+func noDestination(_ *http.Request) string {
+	return ""
 }
@@ -1,14 +1,26 @@
 package http_test
 
 import (
+	"context"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/alicebob/miniredis/v2"
+	"github.com/dnsimple/strillone/internal/dedup"
 	appServer "github.com/dnsimple/strillone/internal/http"
+	"github.com/dnsimple/strillone/internal/outbox"
+	"github.com/dnsimple/strillone/internal/replay"
+	"github.com/dnsimple/strillone/internal/routing"
+	"github.com/dnsimple/strillone/internal/service"
+	"github.com/dnsimple/strillone/internal/throttle"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 var server *appServer.Server
@@ -81,3 +93,556 @@ func TestSlackTwice(t *testing.T) {
 	assert.Equal(t, http.StatusOK, response.Code)
 	assert.Equal(t, "skipped;already-processed", responseDuplicate.Header().Get(appServer.HeaderProcessingStatus))
 }
+
+func TestRecover(t *testing.T) {
+	handler := appServer.WithRequestID(appServer.Recover(http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+		panic("boom")
+	})))
+	request, _ := http.NewRequest("POST", "/slack/1/-/-", nil)
+	request.Header.Set(appServer.HeaderRequestID, "abc-123")
+	response := httptest.NewRecorder()
+
+	assert.NotPanics(t, func() { handler.ServeHTTP(response, request) })
+	assert.Equal(t, http.StatusInternalServerError, response.Code)
+	assert.Equal(t, "abc-123", response.Header().Get(appServer.HeaderRequestID))
+}
+
+func TestSlackPartialPayload(t *testing.T) {
+	payload := `{"name": "domain.delegation_change", "data": {"domain": {"id": 1, "name": "example.com"}}, "request_identifier": "5b5b2ac0-2b8c-4d1a-9f51-4a1c6b7b0a10"}`
+	request, _ := http.NewRequest("POST", "/slack/-/-/-", strings.NewReader(payload))
+	response := httptest.NewRecorder()
+
+	server.ServeHTTP(response, request)
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.NotEmpty(t, response.Header().Get(appServer.HeaderRequestID))
+}
+
+func TestSlackReplayGuard(t *testing.T) {
+	guard, err := replay.NewGuard(time.Hour, 100, "")
+	assert.NoError(t, err)
+	replayServer := appServer.NewServer(appServer.WithReplayGuard(guard))
+
+	stale := `{"data": {"domain": {"id": 1, "name": "example.com", "created_at": "2016-02-07T14:46:29.142Z", "updated_at": "2016-02-07T14:46:29.142Z"}}, "name": "domain.create", "request_identifier": "8f0f5a4e-1b0c-4c7e-9a53-0c8a2b1f9e01"}`
+	request, _ := http.NewRequest("POST", "/slack/-/-/-", strings.NewReader(stale))
+	response := httptest.NewRecorder()
+
+	replayServer.ServeHTTP(response, request)
+
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.Equal(t, "rejected;stale", response.Header().Get(appServer.HeaderProcessingStatus))
+}
+
+func TestSlackSharedDedupStore(t *testing.T) {
+	redisServer := miniredis.RunT(t)
+	newReplica := func() *appServer.Server {
+		store, err := dedup.NewRedisStore("redis://"+redisServer.Addr(), time.Hour, time.Minute)
+		require.NoError(t, err)
+		t.Cleanup(func() { store.Close() })
+		return appServer.NewServer(appServer.WithDedupStore(store))
+	}
+	replicaA, replicaB := newReplica(), newReplica()
+
+	payload := `{"data": {"domain": {"id": 1, "name": "example.com"}}, "name": "domain.create", "request_identifier": "0d7e4c4a-9c39-4a4f-8f8b-3c4b7f6f2e11"}`
+	request, _ := http.NewRequest("POST", "/slack/-/-/-", strings.NewReader(payload))
+	response := httptest.NewRecorder()
+	replicaA.ServeHTTP(response, request)
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Empty(t, response.Header().Get(appServer.HeaderProcessingStatus))
+
+	requestRetry, _ := http.NewRequest("POST", "/slack/-/-/-", strings.NewReader(payload))
+	responseRetry := httptest.NewRecorder()
+	replicaB.ServeHTTP(responseRetry, requestRetry)
+	assert.Equal(t, http.StatusOK, responseRetry.Code)
+	assert.Equal(t, "skipped;already-processed", responseRetry.Header().Get(appServer.HeaderProcessingStatus))
+}
+
+func TestSlackConcurrentDuplicates(t *testing.T) {
+	payload := `{"data": {"domain": {"id": 1, "name": "example.com"}}, "name": "domain.create", "request_identifier": "6a0b7d1e-36c2-4b8e-9f0e-2a7c9d4e5f60"}`
+
+	const deliveries = 20
+	responses := make([]*httptest.ResponseRecorder, deliveries)
+	var wg sync.WaitGroup
+	for i := range deliveries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			request, _ := http.NewRequest("POST", "/slack/-/-/-", strings.NewReader(payload))
+			responses[i] = httptest.NewRecorder()
+			server.ServeHTTP(responses[i], request)
+		}()
+	}
+	wg.Wait()
+
+	published := 0
+	for _, response := range responses {
+		switch status := response.Header().Get(appServer.HeaderProcessingStatus); status {
+		case "":
+			assert.Equal(t, http.StatusOK, response.Code)
+			published++
+		case "skipped;already-processed":
+			assert.Equal(t, http.StatusOK, response.Code)
+		case "skipped;in-flight":
+			assert.Equal(t, http.StatusConflict, response.Code)
+		default:
+			t.Errorf("unexpected processing status %q", status)
+		}
+	}
+	assert.Equal(t, 1, published)
+}
+
+func TestSlackFilter(t *testing.T) {
+	payload := `{"data": {"domain": {"id": 1, "name": "example.com"}}, "name": "domain.create", "request_identifier": "2d4f6b8a-0c1e-4f3a-9b5d-7f9b1d3f5a24"}`
+	request, _ := http.NewRequest("POST", "/slack/-/-/-?include=zone_record.*,dnssec.*", strings.NewReader(payload))
+	response := httptest.NewRecorder()
+	server.ServeHTTP(response, request)
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "skipped;filtered", response.Header().Get(appServer.HeaderProcessingStatus))
+
+	payload = `{"data": {"domain": {"id": 1, "name": "example.com"}}, "name": "domain.renew", "request_identifier": "4f6b8d0c-2e3a-4b5c-8d7f-9b1d3f5b7c46"}`
+	request, _ = http.NewRequest("POST", "/slack/-/-/-?include=domain.*&exclude=domain.create", strings.NewReader(payload))
+	response = httptest.NewRecorder()
+	server.ServeHTTP(response, request)
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Empty(t, response.Header().Get(appServer.HeaderProcessingStatus))
+
+	request, _ = http.NewRequest("POST", "/slack/-/-/-?exclude=domain.[create", strings.NewReader(payload))
+	response = httptest.NewRecorder()
+	server.ServeHTTP(response, request)
+
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+}
+
+type testOutbox struct {
+	destinations []string
+	styles       []service.Style
+}
+
+func (o *testOutbox) Enqueue(_ string, _ []byte, deliveries ...outbox.Delivery) error {
+	for _, delivery := range deliveries {
+		o.destinations = append(o.destinations, delivery.Destination)
+		o.styles = append(o.styles, delivery.Style)
+	}
+	return nil
+}
+
+func TestSlackOutbox(t *testing.T) {
+	box := &testOutbox{}
+	asyncServer := appServer.NewServer(appServer.WithOutbox(box))
+
+	payload := `{"data": {"domain": {"id": 1, "name": "example.com"}}, "name": "domain.create", "request_identifier": "1f3b5d7e-9a0c-4e2f-8b6d-0a1c3e5f7b90"}`
+	request, _ := http.NewRequest("POST", "/slack/T1/B1/C1", strings.NewReader(payload))
+	response := httptest.NewRecorder()
+	asyncServer.ServeHTTP(response, request)
+
+	assert.Equal(t, http.StatusAccepted, response.Code)
+	assert.Equal(t, "queued", response.Header().Get(appServer.HeaderProcessingStatus))
+	assert.Equal(t, []string{"slack/T1/B1/C1"}, box.destinations)
+
+	requestDuplicate, _ := http.NewRequest("POST", "/slack/T1/B1/C1", strings.NewReader(payload))
+	responseDuplicate := httptest.NewRecorder()
+	asyncServer.ServeHTTP(responseDuplicate, requestDuplicate)
+
+	assert.Equal(t, "skipped;already-processed", responseDuplicate.Header().Get(appServer.HeaderProcessingStatus))
+	assert.Len(t, box.destinations, 1)
+}
+
+func TestEvents_PartialFailure(t *testing.T) {
+	var mu sync.Mutex
+	posts := map[string]int{}
+	fakeSlack(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		posts[r.URL.Path]++
+		if r.URL.Path == "/services/T1/B2/brand-a" && posts[r.URL.Path] == 1 {
+			http.Error(w, "channel_is_archived", http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, "ok")
+	})
+	routes, err := routing.Parse([]byte(`
+token: secret
+destinations:
+  ops:
+    type: slack
+    url: https://hooks.slack.com/services/T1/B1/ops
+  brand-a:
+    type: slack
+    url: https://hooks.slack.com/services/T1/B2/brand-a
+routes:
+  - match:
+      events: ["domain.*"]
+    destinations: [ops, brand-a]
+`))
+	require.NoError(t, err)
+	routedServer := appServer.NewServer(appServer.WithRoutes(routes))
+
+	payload := `{"data": {"domain": {"id": 1, "name": "example.com"}}, "name": "domain.create", "request_identifier": "6c8e0a2b-4d5f-4e7a-9b1c-3d5f7a9c1e24"}`
+	request, _ := http.NewRequest("POST", "/events/secret", strings.NewReader(payload))
+	response := httptest.NewRecorder()
+	routedServer.ServeHTTP(response, request)
+	assert.Equal(t, http.StatusInternalServerError, response.Code)
+
+	// The retry of the sender only delivers to the failed destination.
+	request, _ = http.NewRequest("POST", "/events/secret", strings.NewReader(payload))
+	response = httptest.NewRecorder()
+	routedServer.ServeHTTP(response, request)
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, map[string]int{"/services/T1/B1/ops": 1, "/services/T1/B2/brand-a": 2}, posts)
+}
+
+func TestEvents(t *testing.T) {
+	routes, err := routing.Parse([]byte(`
+token: secret
+destinations:
+  ops:
+    type: slack
+    url: https://hooks.slack.com/services/T1/B1/ops
+    exclude: ["zone_record.*"]
+  brand-a:
+    type: slack
+    url: https://hooks.slack.com/services/T1/B2/brand-a
+    include: ["domain.*"]
+routes:
+  - match:
+      events: ["domain.*"]
+    destinations: [ops]
+  - match:
+      domains: ["*.brand-a.com"]
+    destinations: [brand-a, ops]
+`))
+	require.NoError(t, err)
+	box := &testOutbox{}
+	routedServer := appServer.NewServer(appServer.WithRoutes(routes), appServer.WithOutbox(box))
+
+	payload := `{"data": {"domain": {"id": 1, "name": "shop.brand-a.com"}}, "name": "domain.create", "request_identifier": "3a5c7e9b-1d2f-4b6a-8c0e-2f4a6c8e0b13"}`
+	request, _ := http.NewRequest("POST", "/events/secret", strings.NewReader(payload))
+	response := httptest.NewRecorder()
+	routedServer.ServeHTTP(response, request)
+
+	assert.Equal(t, http.StatusAccepted, response.Code)
+	assert.Equal(t, "queued", response.Header().Get(appServer.HeaderProcessingStatus))
+	assert.Equal(t, []string{"slack/T1/B1/ops", "slack/T1/B2/brand-a"}, box.destinations)
+
+	unrouted := `{"data": {"contact": {"id": 1}}, "name": "contact.create", "request_identifier": "7b9d1f3a-5c6e-4a8b-9d0f-6e8a0c2e4a57"}`
+	request, _ = http.NewRequest("POST", "/events/secret", strings.NewReader(unrouted))
+	response = httptest.NewRecorder()
+	routedServer.ServeHTTP(response, request)
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "skipped;unrouted", response.Header().Get(appServer.HeaderProcessingStatus))
+	assert.Len(t, box.destinations, 2)
+
+	filtered := `{"data": {"zone_record": {"id": 1, "zone_id": "shop.brand-a.com"}}, "name": "zone_record.create", "request_identifier": "5e7a9c1d-3f4b-4d6e-8a0c-8b0d2f4a6e35"}`
+	request, _ = http.NewRequest("POST", "/events/secret", strings.NewReader(filtered))
+	response = httptest.NewRecorder()
+	routedServer.ServeHTTP(response, request)
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "skipped;filtered", response.Header().Get(appServer.HeaderProcessingStatus))
+	assert.Len(t, box.destinations, 2)
+
+	request, _ = http.NewRequest("POST", "/events/wrong", strings.NewReader(payload))
+	response = httptest.NewRecorder()
+	routedServer.ServeHTTP(response, request)
+
+	assert.Equal(t, http.StatusNotFound, response.Code)
+}
+
+func TestEventsSynchronous(t *testing.T) {
+	routes, err := routing.Parse([]byte(`
+token: secret
+destinations:
+  ops:
+    type: slack
+    url: https://hooks.slack.com/services/-/-/ops
+  audit:
+    type: slack
+    url: https://hooks.slack.com/services/-/-/audit
+routes:
+  - destinations: [ops, audit]
+`))
+	require.NoError(t, err)
+	routedServer := appServer.NewServer(appServer.WithRoutes(routes))
+
+	payload := `{"data": {"domain": {"id": 1, "name": "example.com"}}, "name": "domain.create", "request_identifier": "9c1e3a5b-7d8f-4c0a-8e2b-4a6c8e0a2c79"}`
+	request, _ := http.NewRequest("POST", "/events/secret", strings.NewReader(payload))
+	response := httptest.NewRecorder()
+	routedServer.ServeHTTP(response, request)
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Empty(t, response.Header().Get(appServer.HeaderProcessingStatus))
+}
+
+func TestActorRules(t *testing.T) {
+	routes, err := routing.Parse([]byte(`
+token: secret
+destinations:
+  ops:
+    type: slack
+    url: https://hooks.slack.com/services/T1/B1/ops
+  dns-automation:
+    type: slack
+    url: https://hooks.slack.com/services/T1/B2/dns-automation
+default: [ops]
+actors:
+  - match:
+      pretty: ["terraform*"]
+    action: redirect
+    destinations: [dns-automation]
+    quiet: true
+  - match:
+      entities: [dnsimple]
+    action: mute
+  - match:
+      ids: ["42"]
+    action: downgrade
+`))
+	require.NoError(t, err)
+	box := &testOutbox{}
+	routedServer := appServer.NewServer(appServer.WithRoutes(routes), appServer.WithOutbox(box))
+
+	tests := []struct {
+		name    string
+		path    string
+		actor   string
+		status  string
+		targets []string
+		quiet   bool
+	}{
+		{name: "redirect", path: "/events/secret", actor: `{"id": "7", "pretty": "terraform-prod"}`, status: "queued", targets: []string{"slack/T1/B2/dns-automation"}, quiet: true},
+		{name: "no redirect from a Slack URL", path: "/slack/T1/B3/legacy", actor: `{"id": "7", "pretty": "terraform-prod"}`, status: "queued", targets: []string{"slack/T1/B3/legacy"}},
+		{name: "mute", path: "/events/secret", actor: `{"id": "1", "entity": "dnsimple"}`, status: "skipped;muted"},
+		{name: "downgrade", path: "/slack/T1/B3/legacy", actor: `{"id": "42"}`, status: "queued", targets: []string{"slack/T1/B3/legacy"}, quiet: true},
+		{name: "no rule", path: "/events/secret", actor: `{"id": "1", "entity": "user"}`, status: "queued", targets: []string{"slack/T1/B1/ops"}},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			box.destinations, box.styles = nil, nil
+			payload := fmt.Sprintf(`{"data": {"domain": {"id": 1, "name": "example.com"}}, "name": "domain.create", "actor": %s, "request_identifier": "actor-rules-%d"}`, tt.actor, i)
+			request, _ := http.NewRequest("POST", tt.path, strings.NewReader(payload))
+			response := httptest.NewRecorder()
+			routedServer.ServeHTTP(response, request)
+
+			assert.Equal(t, tt.status, response.Header().Get(appServer.HeaderProcessingStatus))
+			assert.Equal(t, tt.targets, box.destinations)
+			for _, style := range box.styles {
+				assert.Equal(t, tt.quiet, style.Quiet)
+			}
+		})
+	}
+}
+
+func TestChangeFreezes(t *testing.T) {
+	routes, err := routing.Parse([]byte(`
+token: secret
+destinations:
+  ops:
+    type: slack
+    url: https://hooks.slack.com/services/T1/B1/ops
+    quiet_hours:
+      - from: "00:00"
+        to: "00:00"
+        mode: suppress
+  incidents:
+    type: slack
+    url: https://hooks.slack.com/services/T1/B2/incidents
+default: [ops]
+actors:
+  - match:
+      entities: [dnsimple]
+    action: mute
+freezes:
+  - name: holidays
+    starts_at: 2000-01-01T00:00:00Z
+    ends_at: 2100-01-01T00:00:00Z
+    match:
+      domains: ["suffix:example.com"]
+    mentions: ["<!here>"]
+    destinations: [incidents]
+`))
+	require.NoError(t, err)
+	box := &testOutbox{}
+	routedServer := appServer.NewServer(appServer.WithRoutes(routes), appServer.WithOutbox(box))
+
+	tests := []struct {
+		name    string
+		path    string
+		domain  string
+		entity  string
+		status  string
+		targets []string
+		freeze  string
+	}{
+		{name: "escalated", path: "/events/secret", domain: "www.example.com", entity: "user", status: "queued", targets: []string{"slack/T1/B1/ops", "slack/T1/B2/incidents"}, freeze: "holidays"},
+		{name: "escalated from a Slack URL", path: "/slack/T1/B3/legacy", domain: "example.com", entity: "user", status: "queued", targets: []string{"slack/T1/B3/legacy"}, freeze: "holidays"},
+		{name: "muted", path: "/events/secret", domain: "example.com", entity: "dnsimple", status: "skipped;muted"},
+		{name: "outside the freeze", path: "/events/secret", domain: "example.org", entity: "user", status: "skipped;suppressed"},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			box.destinations, box.styles = nil, nil
+			payload := fmt.Sprintf(`{"data": {"domain": {"id": 1, "name": %q}}, "name": "domain.create", "actor": {"id": "1", "entity": %q}, "request_identifier": "change-freezes-%d"}`, tt.domain, tt.entity, i)
+			request, _ := http.NewRequest("POST", tt.path, strings.NewReader(payload))
+			response := httptest.NewRecorder()
+			routedServer.ServeHTTP(response, request)
+
+			assert.Equal(t, tt.status, response.Header().Get(appServer.HeaderProcessingStatus))
+			assert.Equal(t, tt.targets, box.destinations)
+			for _, style := range box.styles {
+				assert.Equal(t, tt.freeze, style.Freeze)
+				assert.Equal(t, []string{"<!here>"}, style.Mentions)
+			}
+		})
+	}
+}
+
+func TestTenants(t *testing.T) {
+	routes, err := routing.Parse([]byte(`
+token: secret
+destinations:
+  ops:
+    type: slack
+    url: https://hooks.slack.com/services/T1/B1/ops
+default: [ops]
+tenants:
+  brand-a:
+    accounts: ["1010"]
+    token: brand-a-secret
+    dnsimple_url: https://dnsimple.brand-a.test
+    destinations:
+      ops:
+        type: slack
+        url: https://hooks.slack.com/services/T2/B1/ops
+    default: [ops]
+    templates:
+      - text: "{{.text}}"
+  brand-b:
+    accounts: ["brand-b"]
+    destinations:
+      ops:
+        type: slack
+        url: https://hooks.slack.com/services/T3/B1/ops
+        exclude: ["domain.*"]
+    default: [ops]
+`))
+	require.NoError(t, err)
+	box := &testOutbox{}
+	routedServer := appServer.NewServer(appServer.WithRoutes(routes), appServer.WithOutbox(box))
+
+	tests := []struct {
+		name     string
+		path     string
+		account  string
+		code     int
+		status   string
+		targets  []string
+		url      string
+		template string
+	}{
+		{name: "tenant", path: "/events/brand-a-secret", account: `{"id": 1010}`, code: http.StatusAccepted, status: "queued", targets: []string{"slack/T2/B1/ops"}, url: "https://dnsimple.brand-a.test", template: "{{.text}}"},
+		{name: "tenant with the top-level token", path: "/events/secret", account: `{"id": 1010}`, code: http.StatusForbidden, status: "rejected;tenant"},
+		{name: "another tenant", path: "/events/brand-a-secret", account: `{"id": 1, "identifier": "brand-b"}`, code: http.StatusForbidden, status: "rejected;tenant"},
+		{name: "tenant filter", path: "/events/secret", account: `{"id": 1, "identifier": "brand-b"}`, code: http.StatusOK, status: "skipped;filtered"},
+		{name: "no tenant", path: "/events/secret", account: `{"id": 3030}`, code: http.StatusAccepted, status: "queued", targets: []string{"slack/T1/B1/ops"}},
+		{name: "no tenant with a tenant token", path: "/events/brand-a-secret", account: `{"id": 3030}`, code: http.StatusForbidden, status: "rejected;tenant"},
+		{name: "unknown token", path: "/events/other", account: `{"id": 1010}`, code: http.StatusNotFound},
+		{name: "Slack URL", path: "/slack/T1/B3/legacy", account: `{"id": 1010}`, code: http.StatusAccepted, status: "queued", targets: []string{"slack/T1/B3/legacy"}, url: "https://dnsimple.brand-a.test", template: "{{.text}}"},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			box.destinations, box.styles = nil, nil
+			payload := fmt.Sprintf(`{"data": {"domain": {"id": 1, "name": "example.com"}}, "name": "domain.create", "account": %s, "request_identifier": "tenants-%d"}`, tt.account, i)
+			request, _ := http.NewRequest("POST", tt.path, strings.NewReader(payload))
+			response := httptest.NewRecorder()
+			routedServer.ServeHTTP(response, request)
+
+			assert.Equal(t, tt.code, response.Code)
+			assert.Equal(t, tt.status, response.Header().Get(appServer.HeaderProcessingStatus))
+			assert.Equal(t, tt.targets, box.destinations)
+			for _, style := range box.styles {
+				assert.Equal(t, tt.url, style.DNSimpleURL)
+				assert.Equal(t, tt.template, style.Template.String())
+			}
+		})
+	}
+}
+
+func TestThrottledRoutes(t *testing.T) {
+	routes, err := routing.Parse([]byte(`
+token: secret
+destinations:
+  ops:
+    type: slack
+    url: https://hooks.slack.com/services/T1/B1/ops
+  audit:
+    type: slack
+    url: https://hooks.slack.com/services/T1/B2/audit
+    include: ["domain.*"]
+routes:
+  - name: dyndns
+    match:
+      events: ["zone_record.update"]
+    destinations: [ops, audit]
+    cap: 1/h
+  - name: sampled out
+    match:
+      events: ["zone_record.delete"]
+    destinations: [ops]
+    sample: 0.000001
+`))
+	require.NoError(t, err)
+	box := &testOutbox{}
+	events := throttle.New()
+	routedServer := appServer.NewServer(appServer.WithRoutes(routes), appServer.WithOutbox(box), appServer.WithThrottle(events))
+
+	tests := []struct {
+		name    string
+		event   string
+		status  string
+		targets []string
+	}{
+		{name: "under the cap", event: "zone_record.update", status: "queued", targets: []string{"slack/T1/B1/ops"}},
+		{name: "over the cap", event: "zone_record.update", status: "skipped;throttled"},
+		{name: "over the cap again", event: "zone_record.update", status: "skipped;throttled"},
+		{name: "sampled out", event: "zone_record.delete", status: "skipped;throttled"},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			box.destinations, box.styles = nil, nil
+			payload := fmt.Sprintf(`{"data": {"zone_record": {"id": 1, "zone_id": "example.com"}}, "name": %q, "request_identifier": "throttled-routes-%d"}`, tt.event, i)
+			request, _ := http.NewRequest("POST", "/events/secret", strings.NewReader(payload))
+			response := httptest.NewRecorder()
+			routedServer.ServeHTTP(response, request)
+
+			assert.Equal(t, tt.status, response.Header().Get(appServer.HeaderProcessingStatus))
+			assert.Equal(t, tt.targets, box.destinations)
+		})
+	}
+
+	// The duplicates count neither against the cap nor in the summaries.
+	for _, id := range []string{"throttled-routes-0", "throttled-routes-1"} {
+		payload := fmt.Sprintf(`{"data": {"zone_record": {"id": 1, "zone_id": "example.com"}}, "name": "zone_record.update", "request_identifier": %q}`, id)
+		request, _ := http.NewRequest("POST", "/events/secret", strings.NewReader(payload))
+		response := httptest.NewRecorder()
+		routedServer.ServeHTTP(response, request)
+		assert.Equal(t, "skipped;already-processed", response.Header().Get(appServer.HeaderProcessingStatus))
+	}
+
+	// The audit destination doesn't receive the zone record events anyway.
+	posted := map[string]string{}
+	err = events.Flush(context.Background(), time.Now(), func(_ context.Context, destination, text string) error {
+		posted[destination] = text
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"slack/T1/B1/ops": "…and 2 more zone_record.update events for example.com suppressed\n…and 1 more zone_record.delete event for example.com suppressed",
+	}, posted)
+}
@@ -0,0 +1,144 @@
+package http_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	appServer "github.com/dnsimple/strillone/internal/http"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeSelfSignedCert generates a self-signed certificate for 127.0.0.1 and
+// writes the PEM-encoded certificate and key to certFile and keyFile.
+func writeSelfSignedCert(t *testing.T, certFile, keyFile, commonName string, modTime time.Time) *x509.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	require.NoError(t, os.Chtimes(certFile, modTime, modTime))
+	require.NoError(t, os.Chtimes(keyFile, modTime, modTime))
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert
+}
+
+// startTLSServer serves the app with the given TLS configuration. Unlike
+// httptest.Server.StartTLS, it doesn't install its own certificate.
+func startTLSServer(t *testing.T, config *tls.Config, handler http.Handler) string {
+	t.Helper()
+
+	ts := httptest.NewUnstartedServer(handler)
+	ts.Listener = tls.NewListener(ts.Listener, config)
+	ts.Start()
+	t.Cleanup(ts.Close)
+
+	return "https://" + ts.Listener.Addr().String()
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	first := writeSelfSignedCert(t, certFile, keyFile, "first", time.Now().Add(-time.Minute))
+
+	reloader, err := appServer.NewCertReloader(certFile, keyFile)
+	require.NoError(t, err)
+
+	url := startTLSServer(t, appServer.NewTLSConfig(reloader, tls.VersionTLS12, nil), server)
+
+	servedCommonName := func(trusted *x509.Certificate) string {
+		pool := x509.NewCertPool()
+		pool.AddCert(trusted)
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}}}
+		defer client.CloseIdleConnections()
+
+		response, err := client.Get(url)
+		require.NoError(t, err)
+		defer response.Body.Close()
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+		return response.TLS.PeerCertificates[0].Subject.CommonName
+	}
+	assert.Equal(t, "first", servedCommonName(first))
+
+	second := writeSelfSignedCert(t, certFile, keyFile, "second", time.Now())
+	require.NoError(t, reloader.Reload())
+	assert.Equal(t, "second", servedCommonName(second))
+
+	// An invalid pair is rejected and the current certificate is kept.
+	require.NoError(t, os.WriteFile(keyFile, []byte("invalid"), 0o600))
+	require.NoError(t, os.Chtimes(keyFile, time.Now().Add(time.Minute), time.Now().Add(time.Minute)))
+	assert.Error(t, reloader.Reload())
+	assert.Equal(t, "second", servedCommonName(second))
+}
+
+func TestNewTLSConfig_MinVersion(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	cert := writeSelfSignedCert(t, certFile, keyFile, "strillone", time.Now())
+
+	reloader, err := appServer.NewCertReloader(certFile, keyFile)
+	require.NoError(t, err)
+
+	url := startTLSServer(t, appServer.NewTLSConfig(reloader, tls.VersionTLS13, nil), server)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool, MaxVersion: tls.VersionTLS12}}}
+	_, err = client.Get(url) //nolint:bodyclose // the request is expected to fail
+	assert.Error(t, err)
+}
+
+func TestParseCipherSuites(t *testing.T) {
+	suites, err := appServer.ParseCipherSuites("TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256")
+	assert.NoError(t, err)
+	assert.Equal(t, []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}, suites)
+
+	_, err = appServer.ParseCipherSuites("TLS_RSA_WITH_RC4_128_SHA")
+	assert.Error(t, err)
+}
+
+func TestRedirectHandler(t *testing.T) {
+	request, _ := http.NewRequest("POST", "http://strillone.example.com:8080/slack/a/b/c?x=1", nil)
+	response := httptest.NewRecorder()
+
+	appServer.RedirectHandler("8443").ServeHTTP(response, request)
+
+	assert.Equal(t, http.StatusPermanentRedirect, response.Code)
+	assert.Equal(t, "https://strillone.example.com:8443/slack/a/b/c?x=1", response.Header().Get("Location"))
+}
@@ -0,0 +1,101 @@
+// Package outbound provides the HTTP client shared by the publishers, with
+// timeouts, proxy support, a connection pool and request metrics.
+package outbound
+
+import (
+	"expvar"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// stats are published by expvar as "outbound", keyed by destination host.
+var (
+	stats        = expvar.NewMap("outbound")
+	requests     = new(expvar.Map)
+	failures     = new(expvar.Map)
+	responses    = new(expvar.Map)
+	milliseconds = new(expvar.Map)
+)
+
+func init() {
+	stats.Set("requests", requests)
+	stats.Set("errors", failures)
+	stats.Set("responses", responses)
+	stats.Set("duration_ms", milliseconds)
+}
+
+// Options configures the client. Zero values disable the corresponding limit.
+type Options struct {
+	// DialTimeout is the deadline of a TCP connection.
+	DialTimeout time.Duration
+	// TLSHandshakeTimeout is the deadline of a TLS handshake.
+	TLSHandshakeTimeout time.Duration
+	// ResponseHeaderTimeout is how long to wait for the response headers
+	// once the request is sent.
+	ResponseHeaderTimeout time.Duration
+	// Timeout is the deadline of a whole request.
+	Timeout time.Duration
+	// MaxIdleConnsPerHost is the size of the pool of connections kept alive
+	// for each host.
+	MaxIdleConnsPerHost int
+	// IdleConnTimeout is how long an unused connection is kept alive.
+	IdleConnTimeout time.Duration
+	// Proxy returns the proxy of a request, http.ProxyFromEnvironment when nil.
+	Proxy func(*http.Request) (*url.URL, error)
+}
+
+// NewClient returns a client configured with opts. By default, the proxy is
+// taken from the HTTPS_PROXY, HTTP_PROXY and NO_PROXY environment variables.
+func NewClient(opts Options) *http.Client {
+	proxy := opts.Proxy
+	if proxy == nil {
+		proxy = http.ProxyFromEnvironment
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   opts.DialTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+
+	transport := &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		TLSHandshakeTimeout:   opts.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: opts.ResponseHeaderTimeout,
+		ExpectContinueTimeout: time.Second,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   opts.MaxIdleConnsPerHost,
+		IdleConnTimeout:       opts.IdleConnTimeout,
+	}
+
+	return &http.Client{
+		Transport: &instrumentedTransport{next: transport},
+		Timeout:   opts.Timeout,
+	}
+}
+
+// instrumentedTransport counts the requests, errors and responses by host.
+type instrumentedTransport struct {
+	next http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+	start := time.Now()
+
+	resp, err := t.next.RoundTrip(req)
+
+	requests.Add(host, 1)
+	milliseconds.Add(host, time.Since(start).Milliseconds())
+	if err != nil {
+		failures.Add(host, 1)
+		return nil, err
+	}
+	responses.Add(host+" "+strconv.Itoa(resp.StatusCode), 1)
+	return resp, nil
+}
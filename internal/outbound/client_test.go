@@ -0,0 +1,73 @@
+package outbound_test
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/dnsimple/strillone/internal/outbound"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func stat(name, key string) string {
+	value := expvar.Get("outbound").(*expvar.Map).Get(name).(*expvar.Map).Get(key)
+	if value == nil {
+		return ""
+	}
+	return value.String()
+}
+
+func TestClient_Metrics(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	defer server.Close()
+	host := server.Listener.Addr().String()
+
+	client := outbound.NewClient(outbound.Options{Timeout: time.Second})
+	for range 2 {
+		resp, err := client.Get(server.URL)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	assert.Equal(t, "2", stat("requests", host))
+	assert.Equal(t, "2", stat("responses", host+" 418"))
+	assert.Equal(t, "", stat("errors", host))
+}
+
+func TestClient_ResponseHeaderTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+	host := server.Listener.Addr().String()
+
+	client := outbound.NewClient(outbound.Options{ResponseHeaderTimeout: 50 * time.Millisecond})
+	_, err := client.Get(server.URL)
+	require.Error(t, err)
+	assert.Equal(t, "1", stat("errors", host))
+}
+
+func TestClient_Proxy(t *testing.T) {
+	proxied := make(chan string, 1)
+	proxy := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		proxied <- r.URL.String()
+	}))
+	defer proxy.Close()
+	proxyURL, err := url.Parse(proxy.URL)
+	require.NoError(t, err)
+
+	client := outbound.NewClient(outbound.Options{Timeout: time.Second, Proxy: http.ProxyURL(proxyURL)})
+	resp, err := client.Get("http://hooks.example.test/services/T1")
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, "http://hooks.example.test/services/T1", <-proxied)
+}
@@ -0,0 +1,296 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/dnsimple/dnsimple-go/v7/dnsimple/webhook"
+	"github.com/dnsimple/strillone/internal/breaker"
+	"github.com/dnsimple/strillone/internal/dlq"
+	"github.com/dnsimple/strillone/internal/service"
+)
+
+const pollInterval = time.Second
+
+// DeliverFunc delivers an item to its destination.
+type DeliverFunc func(ctx context.Context, item Item) error
+
+// Dispatcher delivers the items of an Outbox with a pool of workers.
+//
+// Failed deliveries are retried according to the delivery policy. After a
+// permanent error or too many attempts, the items are moved to the
+// dead-letter queue when set, and dropped otherwise. The items left in the
+// outbox by a previous run are recovered on Start.
+//
+// The items of a destination about the same account and domain are
+// delivered one at a time, in arrival order, while the other items are
+// delivered concurrently.
+type Dispatcher struct {
+	outbox  *Outbox
+	deliver DeliverFunc
+	workers int
+	policy  service.DeliveryPolicy
+
+	deadLetters *dlq.Queue
+
+	queue chan Item
+	wake  chan struct{}
+
+	mu       sync.Mutex
+	inFlight map[uint64]bool
+
+	stop      context.CancelFunc
+	scheduler sync.WaitGroup
+
+	// Cancels the deliveries in progress when the shutdown times out.
+	deliveries context.Context
+	abort      context.CancelFunc
+	pool       sync.WaitGroup
+}
+
+// NewDispatcher returns a Dispatcher delivering the items of outbox with
+// deliver. The undeliverable items are moved to deadLetters, unless nil.
+func NewDispatcher(outbox *Outbox, deliver DeliverFunc, workers int, policy service.DeliveryPolicy, deadLetters *dlq.Queue) *Dispatcher {
+	return &Dispatcher{
+		outbox:      outbox,
+		deliver:     deliver,
+		workers:     max(workers, 1),
+		policy:      policy,
+		deadLetters: deadLetters,
+		queue:       make(chan Item),
+		wake:        make(chan struct{}, 1),
+		inFlight:    make(map[uint64]bool),
+	}
+}
+
+// Start starts the workers, and schedules the pending items.
+func (d *Dispatcher) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	d.stop = cancel
+	d.deliveries, d.abort = context.WithCancel(context.Background())
+
+	for range d.workers {
+		d.pool.Add(1)
+		go d.work()
+	}
+
+	d.scheduler.Add(1)
+	go d.schedule(ctx)
+}
+
+// Delivery is a destination of an enqueued event, and the style of its
+// messages.
+type Delivery struct {
+	Destination string
+	Style       service.Style
+}
+
+// Enqueue persists an event to be delivered to each of deliveries. They are
+// stored in a single transaction, so that a failed Enqueue can be retried
+// without duplicating the deliveries.
+func (d *Dispatcher) Enqueue(requestID string, payload []byte, deliveries ...Delivery) error {
+	var key string
+	if event, err := webhook.ParseEvent(payload); err == nil {
+		key = service.PartitionKey(event)
+	}
+
+	items := make([]Item, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		item := Item{RequestID: requestID, Destination: delivery.Destination, Style: delivery.Style, Payload: payload}
+		if key != "" {
+			item.Key = delivery.Destination + " " + key
+		}
+		items = append(items, item)
+	}
+
+	if _, err := d.outbox.AddAll(items); err != nil {
+		return err
+	}
+
+	d.signal()
+	return nil
+}
+
+// signal wakes the scheduler up.
+func (d *Dispatcher) signal() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Stop stops scheduling items, and waits for the deliveries in progress to
+// complete or ctx to be done. When ctx is done first, the deliveries in
+// progress are canceled, and Stop returns once the workers are done, so
+// that the outbox can be closed. Undelivered items stay in the outbox.
+func (d *Dispatcher) Stop(ctx context.Context) error {
+	d.stop()
+	d.scheduler.Wait()
+	close(d.queue)
+
+	done := make(chan struct{})
+	go func() {
+		d.pool.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		d.abort()
+		<-done
+		return ctx.Err()
+	}
+}
+
+func (d *Dispatcher) schedule(ctx context.Context) {
+	defer d.scheduler.Done()
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		d.dispatchDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+// dispatchDue sends the items due for delivery to the workers.
+func (d *Dispatcher) dispatchDue(ctx context.Context) {
+	items, err := d.outbox.Pending()
+	if err != nil {
+		log.Printf("Error reading outbox: %v\n", err)
+		return
+	}
+
+	now := time.Now()
+	blocked := make(map[string]bool)
+	for _, item := range items {
+		if item.Key != "" {
+			// The next items of the partition wait for this one, even
+			// when it is in flight or not due yet.
+			if blocked[item.Key] {
+				continue
+			}
+			blocked[item.Key] = true
+		}
+
+		if item.NextAttempt.After(now) || !d.claim(item.ID) {
+			continue
+		}
+
+		select {
+		case d.queue <- item:
+		case <-ctx.Done():
+			d.release(item.ID)
+			return
+		}
+	}
+}
+
+func (d *Dispatcher) work() {
+	defer d.pool.Done()
+
+	for item := range d.queue {
+		d.process(item)
+		d.release(item.ID)
+		// The next item of the partition may be due.
+		d.signal()
+	}
+}
+
+func (d *Dispatcher) process(item Item) {
+	ctx := d.deliveries
+	if d.policy.AttemptTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.policy.AttemptTimeout)
+		defer cancel()
+	}
+
+	err := d.deliver(ctx, item)
+	if err == nil {
+		if err := d.outbox.Delete(item.ID); err != nil {
+			log.Printf("[event:%v] Error removing delivered event from outbox: %v\n", item.RequestID, err)
+		}
+		return
+	}
+
+	if d.deliveries.Err() != nil {
+		log.Printf("[event:%v] Delivery interrupted by the shutdown, kept in the outbox: %v\n", item.RequestID, err)
+		return
+	}
+
+	item.Attempts++
+	item.LastError = err.Error()
+	giveUp := item.Attempts >= d.policy.MaxAttempts || !service.IsRetryable(err)
+	if giveUp && d.deadLetters == nil && errors.Is(err, breaker.ErrOpen) {
+		// Without a dead-letter queue, wait for the circuit to close.
+		giveUp = false
+	}
+	if giveUp {
+		log.Printf("[event:%v] Giving up delivery to %s after %d attempts: %v\n", item.RequestID, item.Destination, item.Attempts, err)
+		if d.deadLetter(item) {
+			if err := d.outbox.Delete(item.ID); err != nil {
+				log.Printf("[event:%v] Error removing event from outbox: %v\n", item.RequestID, err)
+			}
+			return
+		}
+		// Keep retrying rather than losing the event.
+	}
+
+	item.NextAttempt = time.Now().Add(d.policy.Delay(item.Attempts, err))
+	log.Printf("[event:%v] Delivery attempt %d failed, retrying at %s: %v\n", item.RequestID, item.Attempts, item.NextAttempt.Format(time.RFC3339), err)
+	if err := d.outbox.Update(item); err != nil {
+		log.Printf("[event:%v] Error updating outbox: %v\n", item.RequestID, err)
+	}
+}
+
+// deadLetter moves an undeliverable item to the dead-letter queue, and
+// reports whether it can be removed from the outbox.
+func (d *Dispatcher) deadLetter(item Item) bool {
+	if d.deadLetters == nil {
+		return true
+	}
+
+	_, err := d.deadLetters.Add(dlq.Entry{
+		RequestID:   item.RequestID,
+		Destination: item.Destination,
+		Style:       item.Style,
+		Payload:     item.Payload,
+		Attempts:    item.Attempts,
+		LastError:   item.LastError,
+	})
+	if err != nil {
+		log.Printf("[event:%v] Error moving event to the dead-letter queue: %v\n", item.RequestID, err)
+		return false
+	}
+	return true
+}
+
+func (d *Dispatcher) claim(id uint64) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.inFlight[id] {
+		return false
+	}
+	d.inFlight[id] = true
+	return true
+}
+
+func (d *Dispatcher) release(id uint64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.inFlight, id)
+}
@@ -0,0 +1,144 @@
+// Package outbox persists the accepted webhook events until they are
+// delivered, so that the webhook request can be answered right away and
+// pending deliveries survive restarts.
+package outbox
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/dnsimple/strillone/internal/service"
+	bolt "go.etcd.io/bbolt"
+)
+
+var itemsBucket = []byte("items")
+
+// Item is an event waiting to be delivered to a destination.
+type Item struct {
+	// ID is assigned by the outbox, in arrival order.
+	ID          uint64        `json:"id"`
+	RequestID   string        `json:"request_id"`
+	Destination string        `json:"destination"`
+	Style       service.Style `json:"style,omitzero"`
+	Payload     []byte        `json:"payload"`
+	Key         string        `json:"key,omitempty"` // Items with the same key are delivered in arrival order.
+	Attempts    int           `json:"attempts"`
+	LastError   string        `json:"last_error,omitempty"`
+	NextAttempt time.Time     `json:"next_attempt"`
+	CreatedAt   time.Time     `json:"created_at"`
+}
+
+// Outbox is a durable queue of items backed by an embedded bbolt database.
+type Outbox struct {
+	db *bolt.DB
+}
+
+// Open opens or creates the outbox database at path.
+func Open(path string) (*Outbox, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("opening outbox %s: %w", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(itemsBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("initializing outbox %s: %w", path, err)
+	}
+
+	return &Outbox{db: db}, nil
+}
+
+// Add persists a new item, and returns it with its ID assigned.
+func (o *Outbox) Add(item Item) (Item, error) {
+	items, err := o.AddAll([]Item{item})
+	if err != nil {
+		return item, err
+	}
+	return items[0], nil
+}
+
+// AddAll persists new items in a single transaction, so that either all or
+// none are stored, and returns them with their IDs assigned.
+func (o *Outbox) AddAll(items []Item) ([]Item, error) {
+	added := make([]Item, len(items))
+	err := o.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(itemsBucket)
+
+		for i, item := range items {
+			id, err := bucket.NextSequence()
+			if err != nil {
+				return err
+			}
+			item.ID = id
+			if item.CreatedAt.IsZero() {
+				item.CreatedAt = time.Now()
+			}
+
+			if err := putItem(bucket, item); err != nil {
+				return err
+			}
+			added[i] = item
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return added, nil
+}
+
+// Update replaces a stored item.
+func (o *Outbox) Update(item Item) error {
+	return o.db.Update(func(tx *bolt.Tx) error {
+		return putItem(tx.Bucket(itemsBucket), item)
+	})
+}
+
+// Delete removes a delivered item.
+func (o *Outbox) Delete(id uint64) error {
+	return o.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(itemsBucket).Delete(itemKey(id))
+	})
+}
+
+// Pending returns all the stored items, in arrival order.
+func (o *Outbox) Pending() ([]Item, error) {
+	var items []Item
+	err := o.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(itemsBucket).ForEach(func(_, v []byte) error {
+			var item Item
+			if err := json.Unmarshal(v, &item); err != nil {
+				return err
+			}
+			items = append(items, item)
+			return nil
+		})
+	})
+	return items, err
+}
+
+// Close closes the database.
+func (o *Outbox) Close() error {
+	return o.db.Close()
+}
+
+func putItem(bucket *bolt.Bucket, item Item) error {
+	value, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	return bucket.Put(itemKey(item.ID), value)
+}
+
+// itemKey encodes the ID in big endian, so that the keys sort in arrival order.
+func itemKey(id uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, id)
+	return key
+}
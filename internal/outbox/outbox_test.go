@@ -0,0 +1,250 @@
+package outbox_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dnsimple/strillone/internal/breaker"
+	"github.com/dnsimple/strillone/internal/dlq"
+	"github.com/dnsimple/strillone/internal/outbox"
+	"github.com/dnsimple/strillone/internal/service"
+	"github.com/slack-go/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var policy = service.DeliveryPolicy{MaxAttempts: 3, InitialBackoff: 200 * time.Millisecond, MaxBackoff: time.Second}
+
+type recorder struct {
+	mu        sync.Mutex
+	delivered []string
+	failures  int
+	err       error
+}
+
+func (r *recorder) deliver(_ context.Context, item outbox.Item) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.failures > 0 {
+		r.failures--
+		return r.err
+	}
+	r.delivered = append(r.delivered, item.RequestID)
+	return nil
+}
+
+func (r *recorder) Delivered() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.delivered...)
+}
+
+func openOutbox(t *testing.T, path string) *outbox.Outbox {
+	t.Helper()
+
+	box, err := outbox.Open(path)
+	require.NoError(t, err)
+	t.Cleanup(func() { box.Close() })
+	return box
+}
+
+func TestOutbox(t *testing.T) {
+	box := openOutbox(t, filepath.Join(t.TempDir(), "outbox.db"))
+
+	first, err := box.Add(outbox.Item{RequestID: "a", Destination: "slack/-/-/-", Payload: []byte(`{}`)})
+	require.NoError(t, err)
+	second, err := box.Add(outbox.Item{RequestID: "b", Destination: "slack/-/-/-", Payload: []byte(`{}`)})
+	require.NoError(t, err)
+	assert.Less(t, first.ID, second.ID)
+
+	second.Attempts = 2
+	require.NoError(t, box.Update(second))
+	require.NoError(t, box.Delete(first.ID))
+
+	pending, err := box.Pending()
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, "b", pending[0].RequestID)
+	assert.Equal(t, 2, pending[0].Attempts)
+}
+
+func TestOutbox_AddAll(t *testing.T) {
+	box := openOutbox(t, filepath.Join(t.TempDir(), "outbox.db"))
+
+	added, err := box.AddAll([]outbox.Item{
+		{RequestID: "a", Destination: "slack/T1/B1/ops", Payload: []byte(`{}`)},
+		{RequestID: "a", Destination: "slack/T1/B2/dev", Payload: []byte(`{}`)},
+	})
+	require.NoError(t, err)
+	require.Len(t, added, 2)
+	assert.Less(t, added[0].ID, added[1].ID)
+
+	pending, err := box.Pending()
+	require.NoError(t, err)
+	require.Len(t, pending, 2)
+	assert.Equal(t, added[0].ID, pending[0].ID)
+	assert.Equal(t, "slack/T1/B2/dev", pending[1].Destination)
+}
+
+func TestDispatcher(t *testing.T) {
+	box := openOutbox(t, filepath.Join(t.TempDir(), "outbox.db"))
+	destination := &recorder{}
+
+	dispatcher := outbox.NewDispatcher(box, destination.deliver, 2, policy, nil)
+	dispatcher.Start()
+	require.NoError(t, dispatcher.Enqueue("a", []byte(`{}`), outbox.Delivery{Destination: "slack/-/-/-"}))
+
+	assert.Eventually(t, func() bool { return len(destination.Delivered()) == 1 }, time.Second, 10*time.Millisecond)
+	require.NoError(t, dispatcher.Stop(context.Background()))
+
+	pending, err := box.Pending()
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+}
+
+func TestDispatcher_Retry(t *testing.T) {
+	box := openOutbox(t, filepath.Join(t.TempDir(), "outbox.db"))
+	destination := &recorder{failures: 1, err: slack.StatusCodeError{Code: http.StatusServiceUnavailable, Status: "503 Service Unavailable"}}
+
+	dispatcher := outbox.NewDispatcher(box, destination.deliver, 1, policy, nil)
+	dispatcher.Start()
+	defer dispatcher.Stop(context.Background())
+	require.NoError(t, dispatcher.Enqueue("a", []byte(`{}`), outbox.Delivery{Destination: "slack/-/-/-"}))
+
+	assert.Eventually(t, func() bool {
+		pending, err := box.Pending()
+		return err == nil && len(pending) == 1 && pending[0].Attempts == 1
+	}, time.Second, 10*time.Millisecond)
+
+	pending, err := box.Pending()
+	require.NoError(t, err)
+	assert.Equal(t, "slack server error: 503 Service Unavailable", pending[0].LastError)
+	assert.True(t, pending[0].NextAttempt.After(time.Now()))
+
+	// The retry happens after the backoff.
+	assert.Eventually(t, func() bool { return len(destination.Delivered()) == 1 }, 5*time.Second, 50*time.Millisecond)
+}
+
+func TestDispatcher_PermanentError(t *testing.T) {
+	box := openOutbox(t, filepath.Join(t.TempDir(), "outbox.db"))
+	destination := &recorder{failures: 1, err: errors.New("invalid destination")}
+
+	dispatcher := outbox.NewDispatcher(box, destination.deliver, 1, policy, nil)
+	dispatcher.Start()
+	defer dispatcher.Stop(context.Background())
+	require.NoError(t, dispatcher.Enqueue("a", []byte(`{}`), outbox.Delivery{Destination: "slack/-/-/-"}))
+
+	// The item is dropped without retrying.
+	assert.Eventually(t, func() bool {
+		pending, err := box.Pending()
+		return err == nil && len(pending) == 0
+	}, time.Second, 10*time.Millisecond)
+	assert.Empty(t, destination.Delivered())
+}
+
+func TestDispatcher_DeadLetters(t *testing.T) {
+	box := openOutbox(t, filepath.Join(t.TempDir(), "outbox.db"))
+	deadLetters, err := dlq.Open(filepath.Join(t.TempDir(), "dlq.db"))
+	require.NoError(t, err)
+	defer deadLetters.Close()
+	destination := &recorder{failures: 1, err: slack.StatusCodeError{Code: http.StatusNotFound, Status: "404 Not Found"}}
+
+	dispatcher := outbox.NewDispatcher(box, destination.deliver, 1, policy, deadLetters)
+	dispatcher.Start()
+	defer dispatcher.Stop(context.Background())
+	require.NoError(t, dispatcher.Enqueue("a", []byte(`{"name":"domain.create"}`), outbox.Delivery{Destination: "slack/-/-/-", Style: service.Style{Quiet: true}}))
+
+	var entries []dlq.Entry
+	require.Eventually(t, func() bool {
+		entries, err = deadLetters.List()
+		return err == nil && len(entries) == 1
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, "a", entries[0].RequestID)
+	assert.Equal(t, "slack/-/-/-", entries[0].Destination)
+	assert.True(t, entries[0].Style.Quiet)
+	assert.JSONEq(t, `{"name":"domain.create"}`, string(entries[0].Payload))
+	assert.Equal(t, 1, entries[0].Attempts)
+	assert.Equal(t, "slack server error: 404 Not Found", entries[0].LastError)
+
+	assert.Eventually(t, func() bool {
+		pending, err := box.Pending()
+		return err == nil && len(pending) == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestDispatcher_CircuitOpen(t *testing.T) {
+	box := openOutbox(t, filepath.Join(t.TempDir(), "outbox.db"))
+	destination := &recorder{failures: 2, err: &breaker.OpenError{Destination: "slack/-/-/-"}}
+
+	// Without a dead-letter queue, the item waits for the circuit to close.
+	dispatcher := outbox.NewDispatcher(box, destination.deliver, 1, service.DeliveryPolicy{MaxAttempts: 1, InitialBackoff: time.Millisecond}, nil)
+	dispatcher.Start()
+	defer dispatcher.Stop(context.Background())
+	require.NoError(t, dispatcher.Enqueue("a", []byte(`{}`), outbox.Delivery{Destination: "slack/-/-/-"}))
+
+	assert.Eventually(t, func() bool {
+		return len(destination.Delivered()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestDispatcher_Ordering(t *testing.T) {
+	box := openOutbox(t, filepath.Join(t.TempDir(), "outbox.db"))
+
+	var mu sync.Mutex
+	var delivered []string
+	failed := false
+	deliver := func(_ context.Context, item outbox.Item) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		// The first event of example.com is retried.
+		if item.RequestID == "create" && !failed {
+			failed = true
+			return slack.StatusCodeError{Code: http.StatusServiceUnavailable, Status: "503 Service Unavailable"}
+		}
+		delivered = append(delivered, item.RequestID)
+		return nil
+	}
+
+	dispatcher := outbox.NewDispatcher(box, deliver, 4, policy, nil)
+	require.NoError(t, dispatcher.Enqueue("create", []byte(`{"name": "zone_record.create", "account": {"id": 1}, "data": {"zone_record": {"zone_id": "example.com"}}}`), outbox.Delivery{Destination: "slack/-/-/-"}))
+	require.NoError(t, dispatcher.Enqueue("update", []byte(`{"name": "zone_record.update", "account": {"id": 1}, "data": {"zone_record": {"zone_id": "example.com"}}}`), outbox.Delivery{Destination: "slack/-/-/-"}))
+	require.NoError(t, dispatcher.Enqueue("other", []byte(`{"name": "zone_record.create", "account": {"id": 1}, "data": {"zone_record": {"zone_id": "example.org"}}}`), outbox.Delivery{Destination: "slack/-/-/-"}))
+	dispatcher.Start()
+	defer dispatcher.Stop(context.Background())
+
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(delivered) == 3
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// The update waits for the retried create, the other domain doesn't.
+	assert.Equal(t, []string{"other", "create", "update"}, delivered)
+}
+
+func TestDispatcher_Recovery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.db")
+
+	box, err := outbox.Open(path)
+	require.NoError(t, err)
+	_, err = box.Add(outbox.Item{RequestID: "pending", Destination: "slack/-/-/-", Payload: []byte(`{}`)})
+	require.NoError(t, err)
+	require.NoError(t, box.Close())
+
+	// The pending item is delivered after a restart.
+	restarted := openOutbox(t, path)
+	destination := &recorder{}
+	dispatcher := outbox.NewDispatcher(restarted, destination.deliver, 1, policy, nil)
+	dispatcher.Start()
+	defer dispatcher.Stop(context.Background())
+
+	assert.Eventually(t, func() bool { return len(destination.Delivered()) == 1 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"pending"}, destination.Delivered())
+}
@@ -0,0 +1,63 @@
+package replay
+
+import (
+	"hash/fnv"
+	"math"
+)
+
+// bloomFilter is a fixed-size probabilistic set. It never reports a false
+// negative, and the false positive rate is bounded by the parameters chosen
+// in newBloomFilter as long as no more than capacity items are added.
+type bloomFilter struct {
+	Bits  []uint64
+	K     uint32
+	Count uint32
+}
+
+// newBloomFilter sizes a filter for capacity items at the given false positive rate.
+func newBloomFilter(capacity int, falsePositiveRate float64) *bloomFilter {
+	n := float64(capacity)
+	m := math.Ceil(-n * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2))
+	k := math.Max(1, math.Round(m/n*math.Ln2))
+
+	return &bloomFilter{
+		Bits: make([]uint64, (uint64(m)+63)/64),
+		K:    uint32(k),
+	}
+}
+
+func (f *bloomFilter) add(key string) {
+	for _, i := range f.locations(key) {
+		f.Bits[i/64] |= 1 << (i % 64)
+	}
+	f.Count++
+}
+
+func (f *bloomFilter) has(key string) bool {
+	for _, i := range f.locations(key) {
+		if f.Bits[i/64]&(1<<(i%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// locations derives K bit positions using double hashing over FNV-1a.
+func (f *bloomFilter) locations(key string) []uint64 {
+	h := fnv.New128a()
+	_, _ = h.Write([]byte(key))
+	sum := h.Sum(nil)
+
+	var h1, h2 uint64
+	for i := range 8 {
+		h1 = h1<<8 | uint64(sum[i])
+		h2 = h2<<8 | uint64(sum[8+i])
+	}
+
+	size := uint64(len(f.Bits)) * 64
+	locations := make([]uint64, f.K)
+	for i := range locations {
+		locations[i] = (h1 + uint64(i)*h2) % size
+	}
+	return locations
+}
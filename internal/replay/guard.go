@@ -0,0 +1,250 @@
+// Package replay protects the publishers from captured webhook payloads
+// being sent again after the short-lived deduplication cache forgot them.
+package replay
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dnsimple/dnsimple-go/v7/dnsimple/webhook"
+)
+
+const falsePositiveRate = 1e-6
+
+var (
+	// ErrStale is returned when the event timestamps are older than the replay window.
+	ErrStale = errors.New("event is older than the replay window")
+
+	// ErrReplayed is returned when the event request ID was already seen.
+	ErrReplayed = errors.New("event was already seen")
+)
+
+// Guard rejects events that are too old or whose request ID was already seen.
+//
+// Seen request IDs are kept in two generations of bloom filters: when the
+// current generation reaches its capacity it becomes the previous one, so
+// the record stays compact while remembering between capacity and twice
+// capacity IDs. When a path is configured, the filters are persisted by Run
+// and Close so that replays are detected across restarts.
+type Guard struct {
+	window   time.Duration
+	capacity int
+	path     string
+
+	mu       sync.Mutex
+	current  *bloomFilter
+	previous *bloomFilter
+	dirty    bool
+
+	// saveMu serializes the writes of the state file.
+	saveMu sync.Mutex
+}
+
+type guardState struct {
+	Current  *bloomFilter
+	Previous *bloomFilter
+}
+
+// NewGuard returns a Guard rejecting events older than window, remembering
+// about capacity request IDs. A zero window disables the timestamp check, and
+// an empty path keeps the seen IDs in memory only.
+func NewGuard(window time.Duration, capacity int, path string) (*Guard, error) {
+	if capacity <= 0 {
+		return nil, fmt.Errorf("replay capacity must be positive, got %d", capacity)
+	}
+
+	g := &Guard{
+		window:   window,
+		capacity: capacity,
+		path:     path,
+		current:  newBloomFilter(capacity, falsePositiveRate),
+	}
+
+	if path != "" {
+		if err := g.load(); err != nil {
+			return nil, err
+		}
+	}
+
+	return g, nil
+}
+
+// Check returns ErrStale or ErrReplayed if the event must not be published.
+func (g *Guard) Check(event *webhook.Event) error {
+	if g.window > 0 {
+		if ts, ok := Timestamp(event); ok && time.Since(ts) > g.window {
+			return ErrStale
+		}
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.current.has(event.RequestID) || (g.previous != nil && g.previous.has(event.RequestID)) {
+		return ErrReplayed
+	}
+	return nil
+}
+
+// Record remembers the request ID of a published event.
+func (g *Guard) Record(requestID string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if int(g.current.Count) >= g.capacity {
+		g.previous = g.current
+		g.current = newBloomFilter(g.capacity, falsePositiveRate)
+	}
+	g.current.add(requestID)
+	g.dirty = true
+}
+
+// Run saves the state every interval until ctx is done.
+func (g *Guard) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := g.Save(); err != nil {
+				log.Printf("Error saving replay state: %v\n", err)
+			}
+		}
+	}
+}
+
+// Close saves the state.
+func (g *Guard) Close() error {
+	return g.Save()
+}
+
+// Save persists the request IDs recorded since the last save, if a path is
+// configured.
+func (g *Guard) Save() error {
+	if g.path == "" {
+		return nil
+	}
+
+	g.saveMu.Lock()
+	defer g.saveMu.Unlock()
+
+	g.mu.Lock()
+	if !g.dirty {
+		g.mu.Unlock()
+		return nil
+	}
+	var state bytes.Buffer
+	err := gob.NewEncoder(&state).Encode(guardState{Current: g.current, Previous: g.previous})
+	g.dirty = false
+	g.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("encoding replay state: %w", err)
+	}
+
+	if err := g.write(state.Bytes()); err != nil {
+		// Try again on the next save.
+		g.mu.Lock()
+		g.dirty = true
+		g.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Timestamp returns the time of the event, for the events whose data
+// carries it: the created_at or updated_at timestamp of the object created
+// or updated, whichever is the most recent. Webhook payloads don't carry a
+// delivery time, and the timestamps of the other events, such as
+// zone_record.delete or whois_privacy.disable, are the times of an object
+// that may be much older than the event, in which case ok is false.
+func Timestamp(event *webhook.Event) (ts time.Time, ok bool) {
+	if !strings.HasSuffix(event.Name, ".create") && !strings.HasSuffix(event.Name, ".update") {
+		return ts, false
+	}
+
+	var payload struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(event.GetPayload(), &payload); err != nil {
+		return ts, false
+	}
+
+	for _, raw := range payload.Data {
+		var object struct {
+			CreatedAt string `json:"created_at"`
+			UpdatedAt string `json:"updated_at"`
+		}
+		if err := json.Unmarshal(raw, &object); err != nil {
+			continue
+		}
+
+		for _, value := range []string{object.CreatedAt, object.UpdatedAt} {
+			t, err := time.Parse(time.RFC3339, value)
+			if err == nil && t.After(ts) {
+				ts, ok = t, true
+			}
+		}
+	}
+
+	return ts, ok
+}
+
+func (g *Guard) load() error {
+	f, err := os.Open(g.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("opening replay state: %w", err)
+	}
+	defer f.Close()
+
+	var state guardState
+	if err := gob.NewDecoder(f).Decode(&state); err != nil {
+		return fmt.Errorf("decoding replay state %s: %w", g.path, err)
+	}
+	if state.Current != nil {
+		g.current = state.Current
+	}
+	g.previous = state.Previous
+	return nil
+}
+
+// write writes the state to a temporary file, syncs it and renames it, so
+// that a crash can't leave a truncated state behind.
+func (g *Guard) write(state []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(g.path), filepath.Base(g.path)+".*")
+	if err != nil {
+		return fmt.Errorf("saving replay state: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(state); err != nil {
+		tmp.Close()
+		return fmt.Errorf("saving replay state: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("saving replay state: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("saving replay state: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), g.path); err != nil {
+		return fmt.Errorf("saving replay state: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package replay_test
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dnsimple/dnsimple-go/v7/dnsimple/webhook"
+	"github.com/dnsimple/strillone/internal/replay"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func domainEvent(t *testing.T, requestID string, updatedAt time.Time) *webhook.Event {
+	t.Helper()
+	payload := fmt.Sprintf(`{"name": "domain.create", "request_identifier": %q, "data": {"domain": {"id": 1, "name": "example.com", "created_at": "2016-02-07T14:46:29Z", "updated_at": %q}}}`, requestID, updatedAt.UTC().Format(time.RFC3339))
+	event, err := webhook.ParseEvent([]byte(payload))
+	require.NoError(t, err)
+	return event
+}
+
+func TestTimestamp(t *testing.T) {
+	updatedAt := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	ts, ok := replay.Timestamp(domainEvent(t, "1", updatedAt))
+	assert.True(t, ok)
+	assert.Equal(t, updatedAt, ts)
+
+	event, err := webhook.ParseEvent([]byte(`{"name": "account.user_invite", "data": {"account_invitation": {"email": "jane.doe@email.com"}}}`))
+	require.NoError(t, err)
+	_, ok = replay.Timestamp(event)
+	assert.False(t, ok)
+
+	// The timestamps of a deleted record are not the time of the event.
+	event, err = webhook.ParseEvent([]byte(`{"name": "zone_record.delete", "data": {"zone_record": {"id": 1, "created_at": "2024-05-01T10:00:00Z", "updated_at": "2024-05-01T10:00:00Z"}}}`))
+	require.NoError(t, err)
+	_, ok = replay.Timestamp(event)
+	assert.False(t, ok)
+}
+
+func TestGuard_Check(t *testing.T) {
+	guard, err := replay.NewGuard(time.Hour, 100, "")
+	require.NoError(t, err)
+
+	assert.NoError(t, guard.Check(domainEvent(t, "fresh", time.Now())))
+	assert.ErrorIs(t, guard.Check(domainEvent(t, "stale", time.Now().Add(-2*time.Hour))), replay.ErrStale)
+
+	guard.Record("fresh")
+	assert.ErrorIs(t, guard.Check(domainEvent(t, "fresh", time.Now())), replay.ErrReplayed)
+}
+
+func TestGuard_CheckOldResource(t *testing.T) {
+	guard, err := replay.NewGuard(time.Hour, 100, "")
+	require.NoError(t, err)
+
+	// A record created a year ago is deleted now.
+	old := time.Now().AddDate(-1, 0, 0).UTC().Format(time.RFC3339)
+	payload := fmt.Sprintf(`{"name": "zone_record.delete", "request_identifier": "delete", "data": {"zone_record": {"id": 1, "zone_id": "example.com", "created_at": %q, "updated_at": %q}}}`, old, old)
+	event, err := webhook.ParseEvent([]byte(payload))
+	require.NoError(t, err)
+
+	assert.NoError(t, guard.Check(event))
+	guard.Record("delete")
+	assert.ErrorIs(t, guard.Check(event), replay.ErrReplayed)
+}
+
+func TestGuard_Rotation(t *testing.T) {
+	guard, err := replay.NewGuard(0, 10, "")
+	require.NoError(t, err)
+
+	for i := range 25 {
+		guard.Record(fmt.Sprintf("id-%d", i))
+	}
+	// The first generation has been rotated out, the other two are still remembered.
+	assert.NoError(t, guard.Check(domainEvent(t, "id-0", time.Now())))
+	assert.ErrorIs(t, guard.Check(domainEvent(t, "id-10", time.Now())), replay.ErrReplayed)
+	assert.ErrorIs(t, guard.Check(domainEvent(t, "id-24", time.Now())), replay.ErrReplayed)
+}
+
+func TestGuard_Persistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "replay.state")
+
+	guard, err := replay.NewGuard(0, 100, path)
+	require.NoError(t, err)
+	guard.Record("persisted")
+	require.NoError(t, guard.Close())
+
+	// Nothing new to save.
+	require.NoError(t, guard.Save())
+
+	restarted, err := replay.NewGuard(0, 100, path)
+	require.NoError(t, err)
+	assert.ErrorIs(t, restarted.Check(domainEvent(t, "persisted", time.Now())), replay.ErrReplayed)
+	assert.NoError(t, restarted.Check(domainEvent(t, "unknown", time.Now())))
+}
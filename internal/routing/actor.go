@@ -0,0 +1,113 @@
+package routing
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/dnsimple/dnsimple-go/v7/dnsimple/webhook"
+	"github.com/dnsimple/strillone/internal/service"
+)
+
+// The actions of the actor rules.
+const (
+	// ActionMute doesn't publish the events.
+	ActionMute = "mute"
+	// ActionDowngrade publishes the events quietly.
+	ActionDowngrade = "downgrade"
+	// ActionRedirect publishes the events to other destinations.
+	ActionRedirect = "redirect"
+)
+
+// ActorRule changes how the events of some actors, such as the API token of
+// an automation, are published.
+type ActorRule struct {
+	Name  string     `yaml:"name"`
+	Match ActorMatch `yaml:"match"`
+	// Action is mute, downgrade or redirect.
+	Action string `yaml:"action"`
+	// Destinations replace the destinations of the redirected events.
+	Destinations []string `yaml:"destinations"`
+	// Quiet publishes the redirected events quietly.
+	Quiet bool `yaml:"quiet"`
+
+	destinations []*Destination
+}
+
+// ActorMatch are the rules on the actor of an event. An event matches when
+// it satisfies every rule that is set.
+type ActorMatch struct {
+	// IDs are globs of the actor IDs.
+	IDs []string `yaml:"ids"`
+	// Entities are the actor entities, such as "user" or "account".
+	Entities []string `yaml:"entities"`
+	// Pretty are globs of the actor display names, such as "terraform*".
+	Pretty []string `yaml:"pretty"`
+}
+
+// MatchActor returns the first actor rule matching the event, or nil.
+func (c *Config) MatchActor(e *webhook.Event) *ActorRule {
+	if e.Actor == nil {
+		return nil
+	}
+	for _, rule := range c.Actors {
+		if rule.Match.Matches(e.Actor) {
+			return rule
+		}
+	}
+	return nil
+}
+
+// Matches reports whether the actor satisfies the rules.
+func (m *ActorMatch) Matches(actor *webhook.Actor) bool {
+	if len(m.IDs) > 0 && !matchAny(m.IDs, actor.ID) {
+		return false
+	}
+	if len(m.Entities) > 0 && !slices.Contains(m.Entities, actor.Entity) {
+		return false
+	}
+	if len(m.Pretty) > 0 && !matchAny(m.Pretty, actor.Pretty) {
+		return false
+	}
+	return true
+}
+
+// Style returns how the events are presented.
+func (r *ActorRule) Style() service.Style {
+	return service.Style{Quiet: r.Action == ActionDowngrade || (r.Action == ActionRedirect && r.Quiet)}
+}
+
+// Redirect returns the destinations of the redirected events.
+func (r *ActorRule) Redirect() []*Destination {
+	return r.destinations
+}
+
+func (r *ActorRule) validate(c *Config) []error {
+	var errs []error
+
+	if len(r.Match.IDs) == 0 && len(r.Match.Entities) == 0 && len(r.Match.Pretty) == 0 {
+		errs = append(errs, errors.New("match: at least one of ids, entities and pretty is required"))
+	}
+	errs = append(errs, validateGlobs("match.ids", r.Match.IDs)...)
+	errs = append(errs, validateGlobs("match.pretty", r.Match.Pretty)...)
+
+	switch r.Action {
+	case ActionMute, ActionDowngrade:
+		if len(r.Destinations) > 0 {
+			errs = append(errs, fmt.Errorf("destinations: only allowed with the %s action", ActionRedirect))
+		}
+	case ActionRedirect:
+		if len(r.Destinations) == 0 {
+			errs = append(errs, errors.New("destinations: at least one destination is required"))
+		}
+		for _, err := range c.validateDestinations(r.Destinations) {
+			errs = append(errs, fmt.Errorf("destinations: %w", err))
+		}
+		r.destinations = c.appendDestinations(nil, r.Destinations)
+	case "":
+		errs = append(errs, errors.New("action: required"))
+	default:
+		errs = append(errs, fmt.Errorf("action: unknown action %q, expected %s, %s or %s", r.Action, ActionMute, ActionDowngrade, ActionRedirect))
+	}
+	return errs
+}
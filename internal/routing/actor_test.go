@@ -0,0 +1,110 @@
+package routing_test
+
+import (
+	"testing"
+
+	"github.com/dnsimple/dnsimple-go/v7/dnsimple/webhook"
+	"github.com/dnsimple/strillone/internal/routing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const actorsConfig = `
+token: secret
+destinations:
+  ops:
+    type: slack
+    url: https://hooks.slack.com/services/T1/B1/ops
+  dns-automation:
+    type: slack
+    url: https://hooks.slack.com/services/T1/B2/dns-automation
+default: [ops]
+actors:
+  - name: terraform
+    match:
+      pretty: ["terraform*"]
+    action: redirect
+    destinations: [dns-automation]
+    quiet: true
+  - name: renewals
+    match:
+      entities: [dnsimple]
+    action: mute
+  - name: bot
+    match:
+      ids: ["42"]
+      entities: [user]
+    action: downgrade
+`
+
+func TestMatchActor(t *testing.T) {
+	config, err := routing.Parse([]byte(actorsConfig))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name  string
+		actor string
+		rule  string
+	}{
+		{name: "pretty", actor: `{"id": "7", "entity": "access_token", "pretty": "terraform-prod"}`, rule: "terraform"},
+		{name: "entity", actor: `{"id": "1", "entity": "dnsimple", "pretty": "support@dnsimple.com"}`, rule: "renewals"},
+		{name: "id and entity", actor: `{"id": "42", "entity": "user", "pretty": "bot@example.com"}`, rule: "bot"},
+		{name: "id of another entity", actor: `{"id": "42", "entity": "account", "pretty": "bot@example.com"}`, rule: ""},
+		{name: "no actor", actor: `null`, rule: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, err := webhook.ParseEvent([]byte(`{"name": "domain.create", "actor": ` + tt.actor + `}`))
+			require.NoError(t, err)
+
+			rule := config.MatchActor(event)
+			if tt.rule == "" {
+				assert.Nil(t, rule)
+				return
+			}
+			require.NotNil(t, rule)
+			assert.Equal(t, tt.rule, rule.Name)
+		})
+	}
+}
+
+func TestActorRule_Style(t *testing.T) {
+	config, err := routing.Parse([]byte(actorsConfig))
+	require.NoError(t, err)
+
+	assert.True(t, config.Actors[0].Style().Quiet)
+	require.Len(t, config.Actors[0].Redirect(), 1)
+	assert.Equal(t, "dns-automation", config.Actors[0].Redirect()[0].Name)
+	assert.False(t, config.Actors[1].Style().Quiet)
+	assert.True(t, config.Actors[2].Style().Quiet)
+}
+
+func TestParse_InvalidActors(t *testing.T) {
+	_, err := routing.Parse([]byte(`
+token: secret
+destinations:
+  ops:
+    type: slack
+    url: https://hooks.slack.com/services/T1/B1/ops
+actors:
+  - name: everyone
+    action: mute
+  - match:
+      pretty: ["terraform["]
+    action: redirect
+  - match:
+      ids: ["1"]
+    action: downgrade
+    destinations: [ops]
+  - match:
+      ids: ["1"]
+    action: shout
+`))
+	require.Error(t, err)
+
+	assert.Equal(t, `actors[0] (everyone): match: at least one of ids, entities and pretty is required
+actors[1]: match.pretty: invalid pattern "terraform["
+actors[1]: destinations: at least one destination is required
+actors[2]: destinations: only allowed with the redirect action
+actors[3]: action: unknown action "shout", expected mute, downgrade or redirect`, err.Error())
+}
@@ -0,0 +1,354 @@
+// Package routing reads the routing configuration, which declares named
+// destinations and the routes fanning the events out to them.
+package routing
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dnsimple/strillone/internal/schedule"
+	"github.com/dnsimple/strillone/internal/throttle"
+)
+
+// slackWebhookPrefix is the prefix of the Slack incoming webhook URLs.
+const slackWebhookPrefix = "https://hooks.slack.com/services/"
+
+var destinationNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// Config is the routing configuration, usually read from strillone.yaml.
+type Config struct {
+	// Token is the secret of the path of the routed events, /events/{token}.
+	Token        string                  `yaml:"token"`
+	Destinations map[string]*Destination `yaml:"destinations"`
+	Routes       []*Route                `yaml:"routes"`
+	// Default are the destinations of the events matching no route.
+	Default []string `yaml:"default"`
+	// Actors are the rules applied to the events of some actors, before the
+	// routes. The first rule matching an event applies.
+	Actors []*ActorRule `yaml:"actors"`
+	// Freezes are the change freezes, during which the matching events are
+	// escalated.
+	Freezes []*Freeze `yaml:"freezes"`
+	// Templates replace the default message of the events. The first
+	// template matching an event applies.
+	Templates []*Template `yaml:"templates"`
+	// DNSimpleURL is the DNSimple app the links of the messages point to,
+	// DNSIMPLE_URL when empty.
+	DNSimpleURL string `yaml:"dnsimple_url"`
+	// Tenants are the configurations of the events of some accounts.
+	Tenants map[string]*Tenant `yaml:"tenants"`
+
+	accounts map[string]*Tenant
+}
+
+// Destination is a named publisher.
+type Destination struct {
+	// Name is the key of the destination in the configuration.
+	Name string `yaml:"-"`
+	// Type is the type of publisher, such as "slack".
+	Type string `yaml:"type"`
+	// URL is the webhook URL of the publisher.
+	URL string `yaml:"url"`
+	// Filter selects the events published to the destination.
+	Filter `yaml:",inline"`
+	// QuietHours are the daily periods the events are suppressed, deferred
+	// into a digest, or delivered silently.
+	QuietHours []*schedule.QuietHours `yaml:"quiet_hours"`
+
+	target string
+}
+
+// Target returns the destination as used by the delivery pipeline, such as
+// "slack/T00000000/B00000000/XXXXXXXXXXXXXXXXXXXXXXXX".
+func (d *Destination) Target() string {
+	return d.target
+}
+
+// Route sends the events matching its rules to its destinations.
+type Route struct {
+	Name         string   `yaml:"name"`
+	Match        Match    `yaml:"match"`
+	Destinations []string `yaml:"destinations"`
+	// Cap is the number of events of each type the route publishes per
+	// period, such as "10/m", no limit when empty.
+	Cap string `yaml:"cap"`
+	// Sample is the fraction of the events the route publishes, such as 0.1
+	// for one in ten, all of them when 0.
+	Sample float64 `yaml:"sample"`
+
+	key    string
+	limits throttle.Limits
+}
+
+// Key identifies the route across the reloads of the configuration, such as
+// "routes[0] (dyndns)" or "tenants.brand-a.routes[1]".
+func (r *Route) Key() string {
+	return r.key
+}
+
+// Limits returns the cap and the sampling of the route.
+func (r *Route) Limits() throttle.Limits {
+	return r.limits
+}
+
+// Load reads and validates the configuration file at path. The environment
+// variables referenced as ${NAME} are expanded, so that the secrets don't
+// have to be written in the file.
+func Load(path string) (*Config, error) {
+	config, _, err := load(path)
+	return config, err
+}
+
+// load reads and validates the configuration file at path, and returns its
+// content too.
+func load(path string) (*Config, []byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading routing configuration: %w", err)
+	}
+
+	config, err := Parse(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return config, data, nil
+}
+
+// Parse decodes and validates a configuration.
+func Parse(data []byte) (*Config, error) {
+	config := &Config{}
+	if err := decode(data, config); err != nil {
+		return nil, err
+	}
+
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// validate checks the whole configuration, and returns all the errors found.
+func (c *Config) validate() error {
+	errs := c.validateRouting()
+	errs = append(errs, c.validateTenants()...)
+	return errors.Join(errs...)
+}
+
+// validateRouting checks the configuration of the events of c, either the
+// top-level configuration or a tenant.
+func (c *Config) validateRouting() []error {
+	var errs []error
+
+	for _, name := range slices.Sorted(maps.Keys(c.Destinations)) {
+		destination := c.Destinations[name]
+		if destination == nil {
+			destination = &Destination{}
+			c.Destinations[name] = destination
+		}
+		destination.Name = name
+		for _, err := range destination.validate() {
+			errs = append(errs, fmt.Errorf("destinations.%s: %w", name, err))
+		}
+	}
+
+	if (len(c.Routes) > 0 || len(c.Default) > 0) && c.Token == "" {
+		errs = append(errs, errors.New("token: required to receive the routed events"))
+	}
+
+	for _, err := range c.validateDestinations(c.Default) {
+		errs = append(errs, fmt.Errorf("default: %w", err))
+	}
+
+	for i, route := range c.Routes {
+		if route == nil {
+			errs = append(errs, fmt.Errorf("routes[%d]: empty route", i))
+			continue
+		}
+		label := fmt.Sprintf("routes[%d]", i)
+		if route.Name != "" {
+			label += " (" + route.Name + ")"
+		}
+		route.key = label
+		for _, err := range route.validate(c) {
+			errs = append(errs, fmt.Errorf("%s: %w", label, err))
+		}
+	}
+
+	for i, rule := range c.Actors {
+		if rule == nil {
+			errs = append(errs, fmt.Errorf("actors[%d]: empty rule", i))
+			continue
+		}
+		label := fmt.Sprintf("actors[%d]", i)
+		if rule.Name != "" {
+			label += " (" + rule.Name + ")"
+		}
+		for _, err := range rule.validate(c) {
+			errs = append(errs, fmt.Errorf("%s: %w", label, err))
+		}
+	}
+
+	for i, freeze := range c.Freezes {
+		if freeze == nil {
+			errs = append(errs, fmt.Errorf("freezes[%d]: empty freeze", i))
+			continue
+		}
+		label := fmt.Sprintf("freezes[%d]", i)
+		if freeze.Name != "" {
+			label += " (" + freeze.Name + ")"
+		}
+		for _, err := range freeze.validate(c) {
+			errs = append(errs, fmt.Errorf("%s: %w", label, err))
+		}
+	}
+
+	for i, template := range c.Templates {
+		if template == nil {
+			errs = append(errs, fmt.Errorf("templates[%d]: empty template", i))
+			continue
+		}
+		for _, err := range template.validate() {
+			errs = append(errs, fmt.Errorf("templates[%d]: %w", i, err))
+		}
+	}
+
+	if err := validateDNSimpleURL(c.DNSimpleURL); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+func (d *Destination) validate() []error {
+	if !destinationNamePattern.MatchString(d.Name) {
+		return []error{errors.New("the name must only contain lowercase letters, digits, - and _")}
+	}
+
+	var errs []error
+	switch d.Type {
+	case "slack":
+		token, ok := strings.CutPrefix(d.URL, slackWebhookPrefix)
+		if !ok || strings.Count(token, "/") != 2 {
+			errs = append(errs, fmt.Errorf("url: %q is not a Slack incoming webhook URL (%sT.../B.../...)", redact(d.URL), slackWebhookPrefix))
+		}
+		d.target = "slack/" + token
+	case "":
+		errs = append(errs, errors.New("type: required"))
+	default:
+		errs = append(errs, fmt.Errorf("type: unsupported publisher %q", d.Type))
+	}
+	errs = append(errs, d.Filter.validate()...)
+
+	for i, quietHours := range d.QuietHours {
+		if quietHours == nil {
+			errs = append(errs, fmt.Errorf("quiet_hours[%d]: empty period", i))
+			continue
+		}
+		for _, err := range quietHours.Validate() {
+			errs = append(errs, fmt.Errorf("quiet_hours[%d]: %w", i, err))
+		}
+	}
+	return errs
+}
+
+// UsesDigests reports whether the quiet hours of some destinations defer
+// the events into a digest.
+func (c *Config) UsesDigests() bool {
+	for _, tenant := range c.Tenants {
+		if tenant.UsesDigests() {
+			return true
+		}
+	}
+	for _, destination := range c.Destinations {
+		for _, quietHours := range destination.QuietHours {
+			if quietHours != nil && quietHours.Mode == schedule.Digest {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (r *Route) validate(c *Config) []error {
+	var errs []error
+
+	if len(r.Destinations) == 0 {
+		errs = append(errs, errors.New("destinations: at least one destination is required"))
+	}
+	for _, err := range c.validateDestinations(r.Destinations) {
+		errs = append(errs, fmt.Errorf("destinations: %w", err))
+	}
+
+	r.limits = throttle.Limits{Sample: r.Sample}
+	if r.Cap != "" {
+		count, per, err := parseCap(r.Cap)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("cap: %w", err))
+		}
+		r.limits.Count, r.limits.Per = count, per
+	}
+	if r.Sample < 0 || r.Sample > 1 {
+		errs = append(errs, fmt.Errorf("sample: %v is not a fraction between 0 and 1", r.Sample))
+	}
+
+	return append(errs, r.Match.validate()...)
+}
+
+// parseCap parses a cap in the form "count/unit", where unit is one of s, m
+// or h, such as "10/m".
+func parseCap(value string) (int, time.Duration, error) {
+	countValue, unit, ok := strings.Cut(value, "/")
+	count, err := strconv.Atoi(countValue)
+	if !ok || err != nil || count <= 0 {
+		return 0, 0, fmt.Errorf("invalid cap %q, expected count/unit such as 10/m", value)
+	}
+
+	switch unit {
+	case "s":
+		return count, time.Second, nil
+	case "m":
+		return count, time.Minute, nil
+	case "h":
+		return count, time.Hour, nil
+	default:
+		return 0, 0, fmt.Errorf("invalid cap unit in %q, expected s, m or h", value)
+	}
+}
+
+func (c *Config) validateDestinations(names []string) []error {
+	var errs []error
+	for _, name := range names {
+		if _, ok := c.Destinations[name]; !ok {
+			errs = append(errs, fmt.Errorf("unknown destination %q", name))
+		}
+	}
+	return errs
+}
+
+func validateGlobs(field string, patterns []string) []error {
+	var errs []error
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			errs = append(errs, fmt.Errorf("%s: invalid pattern %q", field, pattern))
+		}
+	}
+	return errs
+}
+
+// redact hides the secret path of a URL in the error messages.
+func redact(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Path == "" {
+		return rawURL
+	}
+	return u.Scheme + "://" + u.Host + "/…"
+}
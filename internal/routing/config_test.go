@@ -0,0 +1,224 @@
+package routing_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dnsimple/strillone/internal/routing"
+	"github.com/dnsimple/strillone/internal/schedule"
+	"github.com/dnsimple/strillone/internal/throttle"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const validConfig = `
+token: secret
+destinations:
+  ops:
+    type: slack
+    url: https://hooks.slack.com/services/T1/B1/ops
+  brand-a:
+    type: slack
+    url: https://hooks.slack.com/services/T1/B2/${BRAND_A_SECRET}
+    include: ["zone_record.*", "domain.*"]
+    exclude: ["domain.delete"]
+routes:
+  - name: everything
+    destinations: [ops]
+  - name: brand a
+    match:
+      events: ["domain.*", "zone_record.*"]
+      accounts: [1010]
+      domains: ["*.brand-a.com"]
+    destinations: [brand-a, ops]
+`
+
+func TestParse(t *testing.T) {
+	t.Setenv("BRAND_A_SECRET", "brand-a")
+
+	config, err := routing.Parse([]byte(validConfig))
+	require.NoError(t, err)
+
+	assert.Equal(t, "secret", config.Token)
+	require.Len(t, config.Destinations, 2)
+	assert.Equal(t, "brand-a", config.Destinations["brand-a"].Name)
+	assert.Equal(t, "slack/T1/B2/brand-a", config.Destinations["brand-a"].Target())
+	assert.Equal(t, []string{"domain.delete"}, config.Destinations["brand-a"].Exclude)
+	require.Len(t, config.Routes, 2)
+	assert.Equal(t, []int64{1010}, config.Routes[1].Match.Accounts)
+}
+
+func TestParse_Empty(t *testing.T) {
+	config, err := routing.Parse(nil)
+	require.NoError(t, err)
+
+	assert.Empty(t, config.Routes)
+}
+
+func TestParse_Invalid(t *testing.T) {
+	_, err := routing.Parse([]byte(`
+destinations:
+  Ops:
+    type: slack
+    url: https://hooks.slack.com/services/T1/B1/ops
+  chat:
+    type: hipchat
+    exclude: ["domain.[delete"]
+  alerts:
+    type: slack
+    url: https://example.com/hooks/T1/B1/alerts
+routes:
+  - name: missing
+    match:
+      events: ["domain.[create"]
+    destinations: [nowhere]
+  - name: empty
+`))
+	require.Error(t, err)
+
+	assert.Equal(t, `destinations.Ops: the name must only contain lowercase letters, digits, - and _
+destinations.alerts: url: "https://example.com/…" is not a Slack incoming webhook URL (https://hooks.slack.com/services/T.../B.../...)
+destinations.chat: type: unsupported publisher "hipchat"
+destinations.chat: exclude: invalid pattern "domain.[delete"
+token: required to receive the routed events
+routes[0] (missing): destinations: unknown destination "nowhere"
+routes[0] (missing): match.events: invalid pattern "domain.[create"
+routes[1] (empty): destinations: at least one destination is required`, err.Error())
+}
+
+func TestParse_UnknownField(t *testing.T) {
+	_, err := routing.Parse([]byte(`
+token: secret
+routes:
+  - name: typo
+    destination: [ops]
+`))
+	require.Error(t, err)
+
+	assert.Contains(t, err.Error(), "line 5: field destination not found")
+}
+
+func TestParse_Env(t *testing.T) {
+	t.Setenv("OPS_SECRET", "ops")
+	t.Setenv("OPS_SAMPLE", "0.5")
+
+	config, err := routing.Parse([]byte(`
+token: secret
+destinations:
+  ops:
+    type: slack
+    url: https://hooks.slack.com/services/T1/B1/${OPS_SECRET}
+routes:
+  - destinations: [ops]
+    sample: ${OPS_SAMPLE}
+templates:
+  - text: "{{ $actor := .actor.pretty }}$OPS_SECRET {{ $actor }}"
+`))
+	require.NoError(t, err)
+
+	assert.Equal(t, "slack/T1/B1/ops", config.Destinations["ops"].Target())
+	assert.InDelta(t, 0.5, config.Routes[0].Sample, 0)
+	// Only the ${NAME} references are replaced.
+	assert.Equal(t, "{{ $actor := .actor.pretty }}$OPS_SECRET {{ $actor }}", config.Templates[0].Text)
+}
+
+func TestParse_EnvUnset(t *testing.T) {
+	_, err := routing.Parse([]byte(`
+token: ${STRILLONE_UNSET_TOKEN}
+destinations:
+  ops:
+    type: slack
+    url: https://hooks.slack.com/services/T1/B1/${STRILLONE_UNSET_SECRET}
+`))
+	require.Error(t, err)
+
+	assert.Equal(t, `line 2: environment variable STRILLONE_UNSET_TOKEN is not set
+line 6: environment variable STRILLONE_UNSET_SECRET is not set`, err.Error())
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "strillone.yaml")
+
+	_, err := routing.Load(path)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	require.NoError(t, os.WriteFile(path, []byte("token: [secret"), 0o600))
+	_, err = routing.Load(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), path)
+}
+
+func TestParse_QuietHours(t *testing.T) {
+	config, err := routing.Parse([]byte(`
+destinations:
+  ops:
+    type: slack
+    url: https://hooks.slack.com/services/T1/B1/ops
+    quiet_hours:
+      - from: "22:00"
+        to: "07:00"
+        timezone: Europe/Rome
+      - from: "00:00"
+        to: "00:00"
+        days: [sat, sun]
+        mode: digest
+`))
+	require.NoError(t, err)
+
+	assert.Equal(t, schedule.Silent, config.Destinations["ops"].QuietHours[0].Mode)
+	assert.True(t, config.UsesDigests())
+
+	_, err = routing.Parse([]byte(`
+destinations:
+  ops:
+    type: slack
+    url: https://hooks.slack.com/services/T1/B1/ops
+    quiet_hours:
+      - from: "22:00"
+        to: "7"
+`))
+	assert.EqualError(t, err, `destinations.ops: quiet_hours[0]: to: invalid time "7", expected HH:MM`)
+}
+
+func TestParse_RouteLimits(t *testing.T) {
+	config, err := routing.Parse([]byte(`
+token: secret
+destinations:
+  ops:
+    type: slack
+    url: https://hooks.slack.com/services/T1/B1/ops
+routes:
+  - name: dyndns
+    match:
+      events: ["zone_record.update"]
+    destinations: [ops]
+    cap: 10/m
+    sample: 0.5
+  - destinations: [ops]
+`))
+	require.NoError(t, err)
+
+	assert.Equal(t, "routes[0] (dyndns)", config.Routes[0].Key())
+	assert.Equal(t, throttle.Limits{Count: 10, Per: time.Minute, Sample: 0.5}, config.Routes[0].Limits())
+	assert.True(t, config.Routes[1].Limits().IsZero())
+
+	_, err = routing.Parse([]byte(`
+token: secret
+destinations:
+  ops:
+    type: slack
+    url: https://hooks.slack.com/services/T1/B1/ops
+routes:
+  - destinations: [ops]
+    cap: 10/d
+    sample: 2
+  - destinations: [ops]
+    cap: ten/m
+`))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `routes[0]: cap: invalid cap unit in "10/d", expected s, m or h`)
+	assert.Contains(t, err.Error(), "routes[0]: sample: 2 is not a fraction between 0 and 1")
+	assert.Contains(t, err.Error(), `routes[1]: cap: invalid cap "ten/m", expected count/unit such as 10/m`)
+}
@@ -0,0 +1,143 @@
+package routing
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// envReference matches the ${NAME} references to environment variables.
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+var unmarshalerType = reflect.TypeFor[yaml.Unmarshaler]()
+
+// decode decodes the YAML data into v, after replacing the ${NAME}
+// references of the scalar values with the environment variables. The
+// references to unset variables and the keys without a field in v are
+// rejected, with their line.
+func decode(data []byte, v any) error {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return err
+	}
+	if root.Kind == 0 {
+		// An empty document.
+		return nil
+	}
+
+	errs := expandEnv(&root)
+	errs = append(errs, unknownFields(&root, reflect.TypeOf(v))...)
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	return root.Decode(v)
+}
+
+// expandEnv replaces the ${NAME} references of the scalar values under node,
+// but not of the mapping keys, and returns an error for each unset variable.
+func expandEnv(node *yaml.Node) []error {
+	var errs []error
+	switch node.Kind {
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for _, child := range node.Content {
+			errs = append(errs, expandEnv(child)...)
+		}
+	case yaml.MappingNode:
+		for i := 1; i < len(node.Content); i += 2 {
+			errs = append(errs, expandEnv(node.Content[i])...)
+		}
+	case yaml.ScalarNode:
+		if !envReference.MatchString(node.Value) {
+			return nil
+		}
+		node.Value = envReference.ReplaceAllStringFunc(node.Value, func(reference string) string {
+			name := envReference.FindStringSubmatch(reference)[1]
+			value, ok := os.LookupEnv(name)
+			if !ok {
+				errs = append(errs, fmt.Errorf("line %d: environment variable %s is not set", node.Line, name))
+			}
+			return value
+		})
+		if node.Style&(yaml.TaggedStyle|yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle|yaml.LiteralStyle|yaml.FoldedStyle) == 0 {
+			// Resolve the type of a plain value from what it expands to.
+			node.Tag = ""
+		}
+	}
+	return errs
+}
+
+// unknownFields returns an error for each mapping key under node without a
+// field in t, as the KnownFields option of the decoder does.
+func unknownFields(node *yaml.Node, t reflect.Type) []error {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	if reflect.PointerTo(t).Implements(unmarshalerType) {
+		return nil
+	}
+
+	var errs []error
+	switch {
+	case node.Kind == yaml.DocumentNode:
+		for _, child := range node.Content {
+			errs = append(errs, unknownFields(child, t)...)
+		}
+	case node.Kind == yaml.SequenceNode && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array):
+		for _, child := range node.Content {
+			errs = append(errs, unknownFields(child, t.Elem())...)
+		}
+	case node.Kind == yaml.MappingNode && t.Kind() == reflect.Map:
+		for i := 1; i < len(node.Content); i += 2 {
+			errs = append(errs, unknownFields(node.Content[i], t.Elem())...)
+		}
+	case node.Kind == yaml.MappingNode && t.Kind() == reflect.Struct:
+		fields := yamlFields(t)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if key.Tag == "!!merge" {
+				errs = append(errs, unknownFields(value, t)...)
+				continue
+			}
+			field, ok := fields[key.Value]
+			if !ok {
+				errs = append(errs, fmt.Errorf("line %d: field %s not found in type %s", key.Line, key.Value, t))
+				continue
+			}
+			errs = append(errs, unknownFields(value, field)...)
+		}
+	}
+	return errs
+}
+
+// yamlFields returns the types of the fields of the struct t by YAML key,
+// including the fields of the inlined structs.
+func yamlFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, options, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		switch {
+		case name == "-":
+		case options == "inline" && field.Type.Kind() == reflect.Struct:
+			maps.Copy(fields, yamlFields(field.Type))
+		case name == "":
+			fields[strings.ToLower(field.Name)] = field.Type
+		default:
+			fields[name] = field.Type
+		}
+	}
+	return fields
+}
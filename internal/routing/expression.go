@@ -0,0 +1,95 @@
+package routing
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/dnsimple/dnsimple-go/v7/dnsimple/webhook"
+	"github.com/dnsimple/strillone/internal/service"
+	"github.com/google/cel-go/cel"
+)
+
+// expressionCostLimit bounds the work of an evaluation, so that an
+// expression iterating over a large payload can't stall the deliveries.
+const expressionCostLimit = 100_000
+
+// expressionEnv declares the variables of the event view.
+var expressionEnv = sync.OnceValues(func() (*cel.Env, error) {
+	return cel.NewEnv(
+		cel.Variable("name", cel.StringType),
+		cel.Variable("request_id", cel.StringType),
+		cel.Variable("domain", cel.StringType),
+		cel.Variable("account", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("actor", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("data", cel.MapType(cel.StringType, cel.DynType)),
+	)
+})
+
+// Expression is a CEL expression evaluated against a view of an event, such
+// as `name == "zone_record.create" && data.zone_record.type in ["MX", "TXT"]`.
+//
+// The view has the variables name, request_id, domain (the lowercase domain
+// name the event is about, as matched by the domain patterns), account
+// (id, display and identifier), actor (id, entity and pretty), and data, the
+// event data as found in the payload.
+type Expression struct {
+	source  string
+	program cel.Program
+}
+
+// CompileExpression parses and checks an expression, which must return a bool.
+func CompileExpression(source string) (*Expression, error) {
+	env, err := expressionEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	ast, issues := env.Compile(source)
+	if issues.Err() != nil {
+		var messages []string
+		for _, issue := range issues.Errors() {
+			messages = append(messages, fmt.Sprintf("%d:%d: %s", issue.Location.Line(), issue.Location.Column()+1, issue.Message))
+		}
+		return nil, errors.New(strings.Join(messages, "; "))
+	}
+	if ast.OutputType() != cel.BoolType && ast.OutputType() != cel.DynType {
+		return nil, fmt.Errorf("the expression returns %s instead of bool", ast.OutputType())
+	}
+
+	program, err := env.Program(ast, cel.CostLimit(expressionCostLimit))
+	if err != nil {
+		return nil, err
+	}
+	return &Expression{source: source, program: program}, nil
+}
+
+// String returns the source of the expression.
+func (x *Expression) String() string {
+	return x.source
+}
+
+// Eval evaluates the expression against the event. Accessing a field
+// missing from the event is an error, unless guarded with has().
+func (x *Expression) Eval(e *webhook.Event) (bool, error) {
+	view, err := EventView(e)
+	if err != nil {
+		return false, err
+	}
+
+	out, _, err := x.program.Eval(view)
+	if err != nil {
+		return false, err
+	}
+	result, ok := out.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("the expression returned %v instead of a bool", out.Value())
+	}
+	return result, nil
+}
+
+// EventView returns the variables the expressions are evaluated with.
+func EventView(e *webhook.Event) (map[string]any, error) {
+	return service.EventView(e)
+}
@@ -0,0 +1,122 @@
+package routing_test
+
+import (
+	"testing"
+
+	"github.com/dnsimple/dnsimple-go/v7/dnsimple/webhook"
+	"github.com/dnsimple/strillone/internal/routing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpression_Eval(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		payload    string
+		want       bool
+	}{
+		{
+			name:       "record type",
+			expression: `name.startsWith("zone_record.") && data.zone_record.type in ["MX", "TXT"]`,
+			payload:    `{"name": "zone_record.create", "data": {"zone_record": {"zone_id": "example.com", "type": "TXT"}}}`,
+			want:       true,
+		},
+		{
+			name:       "other record type",
+			expression: `name.startsWith("zone_record.") && data.zone_record.type in ["MX", "TXT"]`,
+			payload:    `{"name": "zone_record.create", "data": {"zone_record": {"zone_id": "example.com", "type": "A"}}}`,
+			want:       false,
+		},
+		{
+			name:       "foreign name servers",
+			expression: `name == "domain.delegation_change" && data.name_servers.exists(ns, !ns.endsWith(".dnsimple.com"))`,
+			payload:    `{"name": "domain.delegation_change", "data": {"domain": {"name": "example.com"}, "name_servers": ["ns1.dnsimple.com", "ns1.example.net"]}}`,
+			want:       true,
+		},
+		{
+			name:       "account, actor and domain",
+			expression: `account.id == 1010 && actor.entity == "user" && domain.endsWith(".example.com")`,
+			payload:    `{"name": "zone.create", "account": {"id": 1010}, "actor": {"id": "1", "entity": "user"}, "data": {"zone": {"name": "Shop.Example.com"}}}`,
+			want:       true,
+		},
+		{
+			name:       "guarded missing field",
+			expression: `has(data.zone_record) && data.zone_record.type == "MX"`,
+			payload:    `{"name": "domain.create", "data": {"domain": {"name": "example.com"}}}`,
+			want:       false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expression, err := routing.CompileExpression(tt.expression)
+			require.NoError(t, err)
+			event, err := webhook.ParseEvent([]byte(tt.payload))
+			require.NoError(t, err)
+
+			got, err := expression.Eval(event)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestExpression_EvalError(t *testing.T) {
+	expression, err := routing.CompileExpression(`data.zone_record.type == "MX"`)
+	require.NoError(t, err)
+	event, err := webhook.ParseEvent([]byte(`{"name": "domain.create", "data": {"domain": {"name": "example.com"}}}`))
+	require.NoError(t, err)
+
+	_, err = expression.Eval(event)
+	assert.EqualError(t, err, "no such key: zone_record")
+}
+
+func TestCompileExpression_Invalid(t *testing.T) {
+	_, err := routing.CompileExpression(`nme == "domain.create"`)
+	assert.EqualError(t, err, "1:1: undeclared reference to 'nme' (in container '')")
+
+	_, err = routing.CompileExpression(`name`)
+	assert.EqualError(t, err, "the expression returns string instead of bool")
+}
+
+func TestResolve_Expression(t *testing.T) {
+	config, err := routing.Parse([]byte(`
+token: secret
+destinations:
+  mail:
+    type: slack
+    url: https://hooks.slack.com/services/T1/B1/mail
+routes:
+  - match:
+      events: ["zone_record.*"]
+      expression: data.zone_record.type in ["MX", "TXT"]
+    destinations: [mail]
+`))
+	require.NoError(t, err)
+
+	event, err := webhook.ParseEvent([]byte(`{"name": "zone_record.update", "data": {"zone_record": {"type": "MX"}}}`))
+	require.NoError(t, err)
+	assert.Len(t, config.Resolve(event), 1)
+
+	event, err = webhook.ParseEvent([]byte(`{"name": "zone_record.update", "data": {"zone_record": {"type": "A"}}}`))
+	require.NoError(t, err)
+	assert.Empty(t, config.Resolve(event))
+}
+
+func TestParse_InvalidExpression(t *testing.T) {
+	_, err := routing.Parse([]byte(`
+token: secret
+destinations:
+  ops:
+    type: slack
+    url: https://hooks.slack.com/services/T1/B1/ops
+routes:
+  - name: typo
+    match:
+      expression: data.zone_record.type in ["MX"
+    destinations: [ops]
+`))
+	require.Error(t, err)
+
+	assert.Contains(t, err.Error(), "routes[0] (typo): match.expression: 1:")
+}
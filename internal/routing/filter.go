@@ -0,0 +1,49 @@
+package routing
+
+import (
+	"errors"
+	"strings"
+)
+
+// Filter selects the events a destination receives by name.
+type Filter struct {
+	// Include are globs of the event names to publish, such as "zone_record.*".
+	// All the events are included when empty.
+	Include []string `yaml:"include"`
+	// Exclude are globs of the event names not to publish, even if included.
+	Exclude []string `yaml:"exclude"`
+}
+
+// ParseFilter returns the filter of the comma-separated lists of globs, as
+// found in the query parameters include and exclude of a URL.
+func ParseFilter(include, exclude []string) (Filter, error) {
+	filter := Filter{Include: splitList(include), Exclude: splitList(exclude)}
+	return filter, errors.Join(filter.validate()...)
+}
+
+func (f *Filter) validate() []error {
+	var errs []error
+	errs = append(errs, validateGlobs("include", f.Include)...)
+	errs = append(errs, validateGlobs("exclude", f.Exclude)...)
+	return errs
+}
+
+// Allows reports whether the event named name passes the filter.
+func (f *Filter) Allows(name string) bool {
+	if len(f.Include) > 0 && !matchAny(f.Include, name) {
+		return false
+	}
+	return !matchAny(f.Exclude, name)
+}
+
+func splitList(values []string) []string {
+	var items []string
+	for _, value := range values {
+		for item := range strings.SplitSeq(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+	}
+	return items
+}
@@ -0,0 +1,34 @@
+package routing_test
+
+import (
+	"testing"
+
+	"github.com/dnsimple/strillone/internal/routing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilter_Allows(t *testing.T) {
+	filter, err := routing.ParseFilter([]string{"zone_record.*,dnssec.*", "domain.renew"}, []string{"zone_record.delete"})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"zone_record.*", "dnssec.*", "domain.renew"}, filter.Include)
+	assert.True(t, filter.Allows("zone_record.create"))
+	assert.True(t, filter.Allows("dnssec.rotation_start"))
+	assert.True(t, filter.Allows("domain.renew"))
+	assert.False(t, filter.Allows("zone_record.delete"))
+	assert.False(t, filter.Allows("domain.register"))
+}
+
+func TestFilter_Empty(t *testing.T) {
+	filter, err := routing.ParseFilter(nil, []string{""})
+	require.NoError(t, err)
+
+	assert.True(t, filter.Allows("domain.create"))
+}
+
+func TestParseFilter_Invalid(t *testing.T) {
+	_, err := routing.ParseFilter([]string{"zone_record.[create"}, nil)
+
+	assert.EqualError(t, err, `include: invalid pattern "zone_record.[create"`)
+}
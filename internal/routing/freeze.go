@@ -0,0 +1,63 @@
+package routing
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dnsimple/dnsimple-go/v7/dnsimple/webhook"
+)
+
+// Freeze is a declared change freeze, such as the holidays or a launch,
+// during which the matching events are escalated.
+type Freeze struct {
+	Name     string    `yaml:"name"`
+	StartsAt time.Time `yaml:"starts_at"`
+	EndsAt   time.Time `yaml:"ends_at"`
+	// Match scopes the freeze, usually to some accounts or domains.
+	Match Match `yaml:"match"`
+	// Mentions are added to the escalated messages, such as "<!here>" or
+	// "<@U0123456>".
+	Mentions []string `yaml:"mentions"`
+	// Destinations also receive the escalated events, such as an incident
+	// channel.
+	Destinations []string `yaml:"destinations"`
+
+	destinations []*Destination
+}
+
+// ActiveFreezes returns the freezes active at now the event matches, in the
+// order they are declared.
+func (c *Config) ActiveFreezes(e *webhook.Event, now time.Time) []*Freeze {
+	var freezes []*Freeze
+	for _, freeze := range c.Freezes {
+		if !now.Before(freeze.StartsAt) && now.Before(freeze.EndsAt) && freeze.Match.Matches(e) {
+			freezes = append(freezes, freeze)
+		}
+	}
+	return freezes
+}
+
+// Incidents returns the destinations also receiving the escalated events.
+func (f *Freeze) Incidents() []*Destination {
+	return f.destinations
+}
+
+func (f *Freeze) validate(c *Config) []error {
+	var errs []error
+
+	if f.Name == "" {
+		errs = append(errs, errors.New("name: required"))
+	}
+	if f.StartsAt.IsZero() || f.EndsAt.IsZero() {
+		errs = append(errs, errors.New("starts_at and ends_at: required"))
+	} else if !f.EndsAt.After(f.StartsAt) {
+		errs = append(errs, errors.New("ends_at: must be after starts_at"))
+	}
+	for _, err := range c.validateDestinations(f.Destinations) {
+		errs = append(errs, fmt.Errorf("destinations: %w", err))
+	}
+	f.destinations = c.appendDestinations(nil, f.Destinations)
+
+	return append(errs, f.Match.validate()...)
+}
@@ -0,0 +1,89 @@
+package routing_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dnsimple/dnsimple-go/v7/dnsimple/webhook"
+	"github.com/dnsimple/strillone/internal/routing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const freezesConfig = `
+token: secret
+destinations:
+  ops:
+    type: slack
+    url: https://hooks.slack.com/services/T1/B1/ops
+  incidents:
+    type: slack
+    url: https://hooks.slack.com/services/T1/B2/incidents
+default: [ops]
+freezes:
+  - name: holidays
+    starts_at: 2026-12-20T00:00:00Z
+    ends_at: 2027-01-04T00:00:00Z
+    match:
+      accounts: [1010]
+    mentions: ["<!here>"]
+    destinations: [incidents]
+  - name: launch
+    starts_at: 2026-12-01T00:00:00Z
+    ends_at: 2026-12-31T00:00:00Z
+    match:
+      domains: ["suffix:example.com"]
+`
+
+func TestActiveFreezes(t *testing.T) {
+	config, err := routing.Parse([]byte(freezesConfig))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		now     string
+		payload string
+		freezes []string
+	}{
+		{name: "account", now: "2026-12-25T12:00:00Z", payload: `{"name": "domain.create", "account": {"id": 1010}}`, freezes: []string{"holidays"}},
+		{name: "both", now: "2026-12-25T12:00:00Z", payload: `{"name": "domain.create", "account": {"id": 1010}, "data": {"domain": {"name": "www.example.com"}}}`, freezes: []string{"holidays", "launch"}},
+		{name: "domain", now: "2026-12-02T12:00:00Z", payload: `{"name": "domain.create", "account": {"id": 1010}, "data": {"domain": {"name": "example.com"}}}`, freezes: []string{"launch"}},
+		{name: "ended", now: "2027-01-04T00:00:00Z", payload: `{"name": "domain.create", "account": {"id": 1010}}`},
+		{name: "another account", now: "2026-12-25T12:00:00Z", payload: `{"name": "domain.create", "account": {"id": 2020}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, err := webhook.ParseEvent([]byte(tt.payload))
+			require.NoError(t, err)
+			now, err := time.Parse(time.RFC3339, tt.now)
+			require.NoError(t, err)
+
+			var names []string
+			for _, freeze := range config.ActiveFreezes(event, now) {
+				names = append(names, freeze.Name)
+			}
+			assert.Equal(t, tt.freezes, names)
+		})
+	}
+
+	require.Len(t, config.Freezes[0].Incidents(), 1)
+	assert.Equal(t, "incidents", config.Freezes[0].Incidents()[0].Name)
+}
+
+func TestParse_InvalidFreeze(t *testing.T) {
+	_, err := routing.Parse([]byte(`
+destinations:
+  ops:
+    type: slack
+    url: https://hooks.slack.com/services/T1/B1/ops
+freezes:
+  - starts_at: 2026-12-20T00:00:00Z
+    ends_at: 2026-12-01T00:00:00Z
+    destinations: [pager]
+`))
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "freezes[0]: name: required")
+	assert.Contains(t, err.Error(), "freezes[0]: ends_at: must be after starts_at")
+	assert.Contains(t, err.Error(), `freezes[0]: destinations: unknown destination "pager"`)
+}
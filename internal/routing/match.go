@@ -0,0 +1,140 @@
+package routing
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/dnsimple/dnsimple-go/v7/dnsimple/webhook"
+	"github.com/dnsimple/strillone/internal/service"
+)
+
+// Match are the rules of a route. An event matches when it satisfies every
+// rule that is set, and a route without rules matches all the events.
+type Match struct {
+	// Events are globs of event names, such as "zone_record.*".
+	Events []string `yaml:"events"`
+	// Accounts are DNSimple account IDs.
+	Accounts []int64 `yaml:"accounts"`
+	// Domains are patterns of the domain names the events are about, such as
+	// "*.example.com", "suffix:example.com" or "regex:^shop[0-9]+\.example\.com$".
+	Domains []string `yaml:"domains"`
+	// Expression is a CEL expression over the event, such as
+	// `data.zone_record.type in ["MX", "TXT"]`.
+	Expression string `yaml:"expression"`
+
+	domains    []namePattern
+	expression *Expression
+}
+
+func (m *Match) validate() []error {
+	errs := validateGlobs("match.events", m.Events)
+
+	m.domains = nil
+	for _, pattern := range m.Domains {
+		compiled, err := compileNamePattern(pattern)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("match.domains: %w", err))
+			continue
+		}
+		m.domains = append(m.domains, compiled)
+	}
+
+	m.expression = nil
+	if m.Expression != "" {
+		expression, err := CompileExpression(m.Expression)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("match.expression: %w", err))
+		}
+		m.expression = expression
+	}
+	return errs
+}
+
+// Matches reports whether the event satisfies the rules.
+func (m *Match) Matches(e *webhook.Event) bool {
+	if len(m.Events) > 0 && !matchAny(m.Events, e.Name) {
+		return false
+	}
+
+	if len(m.Accounts) > 0 && (e.Account == nil || !slices.Contains(m.Accounts, e.Account.ID)) {
+		return false
+	}
+
+	if len(m.domains) > 0 {
+		domain := strings.ToLower(service.DomainName(e))
+		if domain == "" || !slices.ContainsFunc(m.domains, func(match namePattern) bool { return match(domain) }) {
+			return false
+		}
+	}
+
+	if m.expression != nil {
+		ok, err := m.expression.Eval(e)
+		if err != nil {
+			// The events the expression can't be evaluated against don't match.
+			log.Printf("[event:%v] Error evaluating %q: %v\n", e.RequestID, m.expression, err)
+			return false
+		}
+		if !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Resolve returns the destinations of the routes matching the event, in
+// the order of the routes and without duplicates, or the default
+// destinations when no route matches.
+func (c *Config) Resolve(e *webhook.Event) []*Destination {
+	destinations, _ := c.ResolveWith(e, nil)
+	return destinations
+}
+
+// ResolveWith is like Resolve, and skips the matching routes allow rejects,
+// such as the routes over their cap. The destinations of the skipped routes
+// the event is not published to are returned as dropped. A nil allow allows
+// every route.
+func (c *Config) ResolveWith(e *webhook.Event, allow func(*Route) bool) (destinations, dropped []*Destination) {
+	matched := false
+	for _, route := range c.Routes {
+		if !route.Match.Matches(e) {
+			continue
+		}
+		matched = true
+		if allow != nil && !allow(route) {
+			dropped = c.appendDestinations(dropped, route.Destinations)
+			continue
+		}
+		destinations = c.appendDestinations(destinations, route.Destinations)
+	}
+	if !matched {
+		destinations = c.appendDestinations(destinations, c.Default)
+	}
+
+	dropped = slices.DeleteFunc(dropped, func(d *Destination) bool {
+		return slices.Contains(destinations, d)
+	})
+	return destinations, dropped
+}
+
+func (c *Config) appendDestinations(destinations []*Destination, names []string) []*Destination {
+	for _, name := range names {
+		destination := c.Destinations[name]
+		if !slices.Contains(destinations, destination) {
+			destinations = append(destinations, destination)
+		}
+	}
+	return destinations
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
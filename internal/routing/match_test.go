@@ -0,0 +1,224 @@
+package routing_test
+
+import (
+	"testing"
+
+	"github.com/dnsimple/dnsimple-go/v7/dnsimple/webhook"
+	"github.com/dnsimple/strillone/internal/routing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolve(t *testing.T) {
+	t.Setenv("BRAND_A_SECRET", "brand-a")
+	config, err := routing.Parse([]byte(validConfig))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		payload      string
+		destinations []string
+	}{
+		{
+			name:         "matching every rule",
+			payload:      `{"name": "zone_record.update", "account": {"id": 1010}, "data": {"zone_record": {"zone_id": "www.Brand-A.com"}}}`,
+			destinations: []string{"ops", "brand-a"},
+		},
+		{
+			name:         "other event",
+			payload:      `{"name": "contact.create", "account": {"id": 1010}, "data": {"contact": {"id": 1}}}`,
+			destinations: []string{"ops"},
+		},
+		{
+			name:         "other account",
+			payload:      `{"name": "domain.create", "account": {"id": 2020}, "data": {"domain": {"name": "shop.brand-a.com"}}}`,
+			destinations: []string{"ops"},
+		},
+		{
+			name:         "other domain",
+			payload:      `{"name": "domain.create", "account": {"id": 1010}, "data": {"domain": {"name": "example.com"}}}`,
+			destinations: []string{"ops"},
+		},
+		{
+			name:         "no account",
+			payload:      `{"name": "domain.create", "data": {"domain": {"name": "shop.brand-a.com"}}}`,
+			destinations: []string{"ops"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, err := webhook.ParseEvent([]byte(tt.payload))
+			require.NoError(t, err)
+
+			var names []string
+			for _, destination := range config.Resolve(event) {
+				names = append(names, destination.Name)
+			}
+			assert.Equal(t, tt.destinations, names)
+		})
+	}
+}
+
+func TestResolve_NoRoutes(t *testing.T) {
+	config, err := routing.Parse([]byte(`
+destinations:
+  ops:
+    type: slack
+    url: https://hooks.slack.com/services/T1/B1/ops
+`))
+	require.NoError(t, err)
+
+	event, err := webhook.ParseEvent([]byte(`{"name": "domain.create"}`))
+	require.NoError(t, err)
+
+	assert.Empty(t, config.Resolve(event))
+}
+
+func TestResolve_Domains(t *testing.T) {
+	config, err := routing.Parse([]byte(`
+token: secret
+destinations:
+  default:
+    type: slack
+    url: https://hooks.slack.com/services/T1/B1/default
+  brand-a:
+    type: slack
+    url: https://hooks.slack.com/services/T1/B2/brand-a
+  brand-b:
+    type: slack
+    url: https://hooks.slack.com/services/T1/B3/brand-b
+  shops:
+    type: slack
+    url: https://hooks.slack.com/services/T1/B4/shops
+routes:
+  - match:
+      domains: ["*.brand-a.com"]
+    destinations: [brand-a]
+  - match:
+      domains: ["suffix:brand-b.net"]
+    destinations: [brand-b]
+  - match:
+      domains: ["regex:^shop[0-9]+\\."]
+    destinations: [shops]
+default: [default]
+`))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		payload      string
+		destinations []string
+	}{
+		{
+			name:         "domain glob",
+			payload:      `{"name": "domain.create", "data": {"domain": {"name": "www.brand-a.com"}}}`,
+			destinations: []string{"brand-a"},
+		},
+		{
+			name:         "glob not matching the apex",
+			payload:      `{"name": "domain.create", "data": {"domain": {"name": "brand-a.com"}}}`,
+			destinations: []string{"default"},
+		},
+		{
+			name:         "zone suffix",
+			payload:      `{"name": "zone.create", "data": {"zone": {"name": "brand-b.net"}}}`,
+			destinations: []string{"brand-b"},
+		},
+		{
+			name:         "zone record suffix",
+			payload:      `{"name": "zone_record.create", "data": {"zone_record": {"zone_id": "EU.Brand-B.net"}}}`,
+			destinations: []string{"brand-b"},
+		},
+		{
+			name:         "suffix on a label boundary",
+			payload:      `{"name": "zone.create", "data": {"zone": {"name": "notbrand-b.net"}}}`,
+			destinations: []string{"default"},
+		},
+		{
+			name:         "certificate regex",
+			payload:      `{"name": "certificate.issue", "data": {"certificate": {"common_name": "shop42.brand-b.net"}}}`,
+			destinations: []string{"brand-b", "shops"},
+		},
+		{
+			name:         "no domain",
+			payload:      `{"name": "contact.create", "data": {"contact": {"id": 1}}}`,
+			destinations: []string{"default"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, err := webhook.ParseEvent([]byte(tt.payload))
+			require.NoError(t, err)
+
+			var names []string
+			for _, destination := range config.Resolve(event) {
+				names = append(names, destination.Name)
+			}
+			assert.Equal(t, tt.destinations, names)
+		})
+	}
+}
+
+func TestParse_InvalidDomains(t *testing.T) {
+	_, err := routing.Parse([]byte(`
+token: secret
+destinations:
+  ops:
+    type: slack
+    url: https://hooks.slack.com/services/T1/B1/ops
+routes:
+  - match:
+      domains: ["regex:shop[", "suffix:", "exact:example.com", "[a"]
+    destinations: [ops]
+default: [nowhere]
+`))
+	require.Error(t, err)
+
+	assert.Equal(t, `default: unknown destination "nowhere"
+routes[0]: match.domains: invalid pattern "regex:shop[": error parsing regexp: missing closing ]: `+"`[`"+`
+routes[0]: match.domains: invalid pattern "suffix:": empty suffix
+routes[0]: match.domains: invalid pattern "exact:example.com": unknown kind "exact", expected glob, suffix or regex
+routes[0]: match.domains: invalid pattern "[a"`, err.Error())
+}
+
+func TestResolveWith(t *testing.T) {
+	config, err := routing.Parse([]byte(`
+token: secret
+destinations:
+  ops:
+    type: slack
+    url: https://hooks.slack.com/services/T1/B1/ops
+  dns:
+    type: slack
+    url: https://hooks.slack.com/services/T1/B2/dns
+  audit:
+    type: slack
+    url: https://hooks.slack.com/services/T1/B3/audit
+routes:
+  - name: dyndns
+    match:
+      events: ["zone_record.*"]
+    destinations: [ops, dns]
+    cap: 1/m
+  - name: audit
+    destinations: [audit, ops]
+default: [ops]
+`))
+	require.NoError(t, err)
+	event, err := webhook.ParseEvent([]byte(`{"name": "zone_record.update"}`))
+	require.NoError(t, err)
+
+	destinations, dropped := config.ResolveWith(event, func(route *routing.Route) bool {
+		return route.Limits().IsZero()
+	})
+	assert.Equal(t, []string{"audit", "ops"}, destinationNames(destinations))
+	assert.Equal(t, []string{"dns"}, destinationNames(dropped))
+}
+
+func destinationNames(destinations []*routing.Destination) []string {
+	var names []string
+	for _, destination := range destinations {
+		names = append(names, destination.Name)
+	}
+	return names
+}
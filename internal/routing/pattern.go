@@ -0,0 +1,51 @@
+package routing
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// namePattern matches the lowercase domain names.
+type namePattern func(name string) bool
+
+// compileNamePattern compiles a pattern of domain names, written as:
+//
+//   - a glob, such as "*.example.com"
+//   - "suffix:example.com", matching example.com and all its subdomains
+//   - "regex:^shop[0-9]+\.example\.com$", a regular expression
+func compileNamePattern(pattern string) (namePattern, error) {
+	kind, value, ok := strings.Cut(pattern, ":")
+	if !ok {
+		kind, value = "glob", pattern
+	}
+
+	switch kind {
+	case "glob":
+		value = strings.ToLower(value)
+		if _, err := path.Match(value, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q", pattern)
+		}
+		return func(name string) bool {
+			ok, _ := path.Match(value, name)
+			return ok
+		}, nil
+	case "suffix":
+		value = strings.ToLower(strings.TrimPrefix(value, "."))
+		if value == "" {
+			return nil, fmt.Errorf("invalid pattern %q: empty suffix", pattern)
+		}
+		return func(name string) bool {
+			return name == value || strings.HasSuffix(name, "."+value)
+		}, nil
+	case "regex":
+		re, err := regexp.Compile(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+		return re.MatchString, nil
+	default:
+		return nil, fmt.Errorf("invalid pattern %q: unknown kind %q, expected glob, suffix or regex", pattern, kind)
+	}
+}
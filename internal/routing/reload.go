@@ -0,0 +1,193 @@
+package routing
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"expvar"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// stats are published by expvar as "routing": the number of reloads, the
+// number of rejected configurations, and when the current one was loaded.
+var (
+	stats    = expvar.NewMap("routing")
+	loadedAt = new(expvar.String)
+)
+
+func init() {
+	stats.Set("loaded_at", loadedAt)
+}
+
+// reloadDelay groups the file events of a single change, as editors and
+// deployments usually write a file in several steps.
+const reloadDelay = 250 * time.Millisecond
+
+// Reloader serves the configuration loaded from a file, and reloads it on
+// demand or when the file changes, so that routes can be changed without a
+// restart. An invalid configuration is rejected, and the current one stays
+// active.
+type Reloader struct {
+	path  string
+	check func(*Config) error
+
+	config atomic.Pointer[Config]
+
+	mu     sync.Mutex
+	sum    []byte
+	status ReloadStatus
+}
+
+// ReloadStatus describes the configuration currently active, and the last
+// reload attempts.
+type ReloadStatus struct {
+	Path     string    `json:"path"`
+	Checksum string    `json:"checksum"`
+	LoadedAt time.Time `json:"loaded_at"`
+	// Reloads and Failures count the reloads since the start.
+	Reloads   int64     `json:"reloads"`
+	Failures  int64     `json:"failures"`
+	LastError string    `json:"last_error,omitempty"`
+	FailedAt  time.Time `json:"failed_at,omitzero"`
+}
+
+// NewReloader loads the configuration file at path. check validates the
+// configurations against the rest of the application, and may be nil.
+func NewReloader(path string, check func(*Config) error) (*Reloader, error) {
+	r := &Reloader{path: path, check: check}
+
+	config, data, err := r.load()
+	if err != nil {
+		return nil, err
+	}
+	r.swap(config, data)
+	return r, nil
+}
+
+// NewPendingReloader returns a Reloader of the configuration file at path,
+// which doesn't exist yet. The configuration is empty, routing nothing, until
+// the file is created and reloaded.
+func NewPendingReloader(path string, check func(*Config) error) *Reloader {
+	r := &Reloader{path: path, check: check}
+	r.config.Store(&Config{})
+	r.status.Path = path
+	return r
+}
+
+// Config returns the active configuration.
+func (r *Reloader) Config() *Config {
+	return r.config.Load()
+}
+
+// Status returns the status of the active configuration.
+func (r *Reloader) Status() ReloadStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.status
+}
+
+// Reload loads the configuration file again, and activates it once valid.
+func (r *Reloader) Reload() error {
+	return r.reload(false)
+}
+
+// Watch reloads the configuration when its file changes, until ctx is done.
+// The directory of the file is watched, so that the files replaced by a
+// rename, such as the Kubernetes config maps, are reloaded too.
+func (r *Reloader) Watch(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("watching routing configuration: %w", err)
+	}
+	defer watcher.Close()
+	if err := watcher.Add(filepath.Dir(r.path)); err != nil {
+		return fmt.Errorf("watching routing configuration: %w", err)
+	}
+
+	timer := time.NewTimer(reloadDelay)
+	timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-watcher.Events:
+			timer.Reset(reloadDelay)
+		case err := <-watcher.Errors:
+			log.Printf("Error watching %s: %v\n", r.path, err)
+		case <-timer.C:
+			// The errors are logged and recorded in the status.
+			_ = r.reload(true)
+		}
+	}
+}
+
+// reload loads and activates the configuration, unless the file is
+// unchanged and onlyChanged is set.
+func (r *Reloader) reload(onlyChanged bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if onlyChanged {
+		data, err := os.ReadFile(r.path)
+		if err == nil && bytes.Equal(checksum(data), r.sum) {
+			return nil
+		}
+	}
+
+	config, data, err := r.load()
+	if err != nil {
+		r.status.Failures++
+		r.status.LastError = err.Error()
+		r.status.FailedAt = time.Now()
+		stats.Add("reload_errors", 1)
+		log.Printf("Error reloading the routing configuration, keeping the active one: %v\n", err)
+		return err
+	}
+
+	r.swap(config, data)
+	r.status.Reloads++
+	stats.Add("reloads", 1)
+	log.Printf("Reloaded %d routes to %d destinations and %d tenants from %s\n", len(config.Routes), len(config.Destinations), len(config.Tenants), r.path)
+	return nil
+}
+
+// load reads, validates and checks the configuration file.
+func (r *Reloader) load() (*Config, []byte, error) {
+	config, data, err := load(r.path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if r.check != nil {
+		if err := r.check(config); err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", r.path, err)
+		}
+	}
+	return config, data, nil
+}
+
+// swap activates the configuration read from data.
+func (r *Reloader) swap(config *Config, data []byte) {
+	r.config.Store(config)
+	r.sum = checksum(data)
+
+	now := time.Now()
+	r.status.Path = r.path
+	r.status.Checksum = hex.EncodeToString(r.sum)
+	r.status.LoadedAt = now
+	loadedAt.Set(now.Format(time.RFC3339))
+}
+
+func checksum(data []byte) []byte {
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
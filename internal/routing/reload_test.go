@@ -0,0 +1,109 @@
+package routing_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dnsimple/strillone/internal/routing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const reloadConfig = `
+token: secret
+destinations:
+  ops:
+    type: slack
+    url: https://hooks.slack.com/services/T1/B1/ops
+default: [ops]
+`
+
+func writeConfig(t *testing.T, path, content string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+}
+
+func TestReloader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "strillone.yaml")
+	writeConfig(t, path, reloadConfig)
+
+	reloader, err := routing.NewReloader(path, func(config *routing.Config) error {
+		if config.Token == "forbidden" {
+			return errors.New("forbidden token")
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	initial := reloader.Config()
+	assert.Equal(t, "secret", initial.Token)
+	assert.Equal(t, path, reloader.Status().Path)
+	assert.NotEmpty(t, reloader.Status().Checksum)
+
+	writeConfig(t, path, "token: [")
+	require.Error(t, reloader.Reload())
+	assert.Same(t, initial, reloader.Config())
+
+	writeConfig(t, path, "token: forbidden")
+	err = reloader.Reload()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "forbidden token")
+	assert.Same(t, initial, reloader.Config())
+
+	status := reloader.Status()
+	assert.Equal(t, int64(0), status.Reloads)
+	assert.Equal(t, int64(2), status.Failures)
+	assert.Contains(t, status.LastError, "forbidden token")
+
+	writeConfig(t, path, "token: other")
+	require.NoError(t, reloader.Reload())
+	assert.Equal(t, "other", reloader.Config().Token)
+	assert.Equal(t, int64(1), reloader.Status().Reloads)
+}
+
+func TestReloader_Watch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "strillone.yaml")
+	writeConfig(t, path, reloadConfig)
+	reloader, err := routing.NewReloader(path, nil)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- reloader.Watch(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		assert.NoError(t, <-done)
+	})
+	// Let the watcher start.
+	time.Sleep(50 * time.Millisecond)
+
+	// The file replaced by a rename is reloaded too.
+	next := filepath.Join(filepath.Dir(path), "next.yaml")
+	writeConfig(t, next, "token: renamed")
+	require.NoError(t, os.Rename(next, path))
+	assert.Eventually(t, func() bool { return reloader.Config().Token == "renamed" }, 5*time.Second, 10*time.Millisecond)
+
+	writeConfig(t, path, "token: [")
+	assert.Eventually(t, func() bool { return reloader.Status().Failures == 1 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "renamed", reloader.Config().Token)
+}
+
+func TestPendingReloader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "strillone.yaml")
+	_, err := routing.NewReloader(path, nil)
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	reloader := routing.NewPendingReloader(path, nil)
+	assert.Empty(t, reloader.Config().Tokens())
+	assert.Equal(t, path, reloader.Status().Path)
+	assert.Empty(t, reloader.Status().Checksum)
+
+	// Reloaded once the file is created.
+	writeConfig(t, path, reloadConfig)
+	require.NoError(t, reloader.Reload())
+	assert.NotEmpty(t, reloader.Config().Tokens())
+	assert.NotEmpty(t, reloader.Status().Checksum)
+}
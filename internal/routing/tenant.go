@@ -0,0 +1,167 @@
+package routing
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net/url"
+	"slices"
+	"strconv"
+
+	"github.com/dnsimple/dnsimple-go/v7/dnsimple/webhook"
+	"github.com/dnsimple/strillone/internal/service"
+)
+
+// Tenant is the configuration of the events of some DNSimple accounts,
+// isolated from the other tenants: its routes can only publish to its own
+// destinations.
+type Tenant struct {
+	// Name is the key of the tenant in the configuration.
+	Name string `yaml:"-"`
+	// Accounts are the IDs or the identifiers of the DNSimple accounts of the
+	// tenant.
+	Accounts []string `yaml:"accounts"`
+	Config   `yaml:",inline"`
+}
+
+// Template replaces the default message of the events it matches.
+type Template struct {
+	// Events are globs of event names, all the events when empty.
+	Events []string `yaml:"events"`
+	// Text is a text/template executed with the view of the event.
+	Text string `yaml:"text"`
+
+	parsed *service.Template
+}
+
+// Tenant returns the tenant of the account of the event, or nil.
+func (c *Config) Tenant(e *webhook.Event) *Tenant {
+	if c == nil || e.Account == nil {
+		return nil
+	}
+	if tenant, ok := c.accounts[strconv.FormatInt(e.Account.ID, 10)]; ok && e.Account.ID != 0 {
+		return tenant
+	}
+	if tenant, ok := c.accounts[e.Account.Identifier]; ok && e.Account.Identifier != "" {
+		return tenant
+	}
+	return nil
+}
+
+// For returns the configuration of the tenant of the event, or c when the
+// event belongs to no tenant.
+func (c *Config) For(e *webhook.Event) *Config {
+	if tenant := c.Tenant(e); tenant != nil {
+		return &tenant.Config
+	}
+	return c
+}
+
+// Tokens returns the tokens of the paths of the routed events.
+func (c *Config) Tokens() []string {
+	var tokens []string
+	if c.Token != "" {
+		tokens = append(tokens, c.Token)
+	}
+	for _, name := range slices.Sorted(maps.Keys(c.Tenants)) {
+		if token := c.Tenants[name].Token; token != "" && !slices.Contains(tokens, token) {
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens
+}
+
+// Template returns the first template matching the event, or nil.
+func (c *Config) Template(e *webhook.Event) *service.Template {
+	for _, template := range c.Templates {
+		if len(template.Events) == 0 || matchAny(template.Events, e.Name) {
+			return template.parsed
+		}
+	}
+	return nil
+}
+
+// Style returns how the event is presented at the destinations of c.
+func (c *Config) Style(e *webhook.Event) service.Style {
+	return service.Style{DNSimpleURL: c.DNSimpleURL, Template: c.Template(e)}
+}
+
+// validateTenants checks the tenants, and indexes them by account.
+func (c *Config) validateTenants() []error {
+	var errs []error
+
+	c.accounts = map[string]*Tenant{}
+	tokens := map[string]string{}
+	for _, name := range slices.Sorted(maps.Keys(c.Tenants)) {
+		tenant := c.Tenants[name]
+		if tenant == nil {
+			tenant = &Tenant{}
+			c.Tenants[name] = tenant
+		}
+		tenant.Name = name
+
+		var tenantErrs []error
+		if !destinationNamePattern.MatchString(name) {
+			tenantErrs = append(tenantErrs, errors.New("the name must only contain lowercase letters, digits, - and _"))
+		}
+		if len(tenant.Accounts) == 0 {
+			tenantErrs = append(tenantErrs, errors.New("accounts: at least one account is required"))
+		}
+		for _, account := range tenant.Accounts {
+			if other, ok := c.accounts[account]; ok {
+				tenantErrs = append(tenantErrs, fmt.Errorf("accounts: %q is also an account of the tenant %q", account, other.Name))
+				continue
+			}
+			c.accounts[account] = tenant
+		}
+		if len(tenant.Tenants) > 0 {
+			tenantErrs = append(tenantErrs, errors.New("tenants: not allowed in a tenant"))
+		}
+
+		if tenant.Token != "" {
+			if tenant.Token == c.Token {
+				tenantErrs = append(tenantErrs, errors.New("token: must differ from the top-level token"))
+			} else if other, ok := tokens[tenant.Token]; ok {
+				tenantErrs = append(tenantErrs, fmt.Errorf("token: must differ from the token of the tenant %q", other))
+			}
+			tokens[tenant.Token] = name
+		} else {
+			// The events of the tenant are received with the top-level token.
+			tenant.Token = c.Token
+		}
+
+		tenantErrs = append(tenantErrs, tenant.Config.validateRouting()...)
+		for _, route := range tenant.Routes {
+			if route != nil {
+				route.key = "tenants." + name + "." + route.key
+			}
+		}
+		for _, err := range tenantErrs {
+			errs = append(errs, fmt.Errorf("tenants.%s: %w", name, err))
+		}
+	}
+	return errs
+}
+
+func (t *Template) validate() []error {
+	errs := validateGlobs("events", t.Events)
+	if t.Text == "" {
+		errs = append(errs, errors.New("text: required"))
+	} else if parsed, err := service.ParseTemplate(t.Text); err != nil {
+		errs = append(errs, fmt.Errorf("text: %w", err))
+	} else {
+		t.parsed = parsed
+	}
+	return errs
+}
+
+func validateDNSimpleURL(rawURL string) error {
+	if rawURL == "" {
+		return nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return fmt.Errorf("dnsimple_url: %q is not an HTTP(S) URL", rawURL)
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package routing_test
+
+import (
+	"testing"
+
+	"github.com/dnsimple/dnsimple-go/v7/dnsimple/webhook"
+	"github.com/dnsimple/strillone/internal/routing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const tenantsConfig = `
+token: secret
+destinations:
+  ops:
+    type: slack
+    url: https://hooks.slack.com/services/T1/B1/ops
+default: [ops]
+tenants:
+  brand-a:
+    accounts: ["1010", "brand-a"]
+    token: brand-a-secret
+    dnsimple_url: https://dnsimple.brand-a.test
+    destinations:
+      ops:
+        type: slack
+        url: https://hooks.slack.com/services/T2/B1/ops
+    default: [ops]
+    templates:
+      - events: ["domain.*"]
+        text: "{{.actor.pretty}} changed {{.domain}}"
+      - text: "{{.text}}"
+  brand-b:
+    accounts: ["2020"]
+    destinations:
+      ops:
+        type: slack
+        url: https://hooks.slack.com/services/T3/B1/ops
+    default: [ops]
+`
+
+func TestConfig_For(t *testing.T) {
+	config, err := routing.Parse([]byte(tenantsConfig))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		account string
+		tenant  string
+		target  string
+		token   string
+	}{
+		{name: "account ID", account: `{"id": 1010}`, tenant: "brand-a", target: "slack/T2/B1/ops", token: "brand-a-secret"},
+		{name: "account identifier", account: `{"id": 1, "identifier": "brand-a"}`, tenant: "brand-a", target: "slack/T2/B1/ops", token: "brand-a-secret"},
+		{name: "inherited token", account: `{"id": 2020}`, tenant: "brand-b", target: "slack/T3/B1/ops", token: "secret"},
+		{name: "no tenant", account: `{"id": 3030}`, target: "slack/T1/B1/ops", token: "secret"},
+		{name: "no account", account: `null`, target: "slack/T1/B1/ops", token: "secret"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, err := webhook.ParseEvent([]byte(`{"name": "domain.create", "account": ` + tt.account + `}`))
+			require.NoError(t, err)
+
+			tenant := config.Tenant(event)
+			if tt.tenant == "" {
+				assert.Nil(t, tenant)
+			} else {
+				require.NotNil(t, tenant)
+				assert.Equal(t, tt.tenant, tenant.Name)
+			}
+
+			routes := config.For(event)
+			destinations := routes.Resolve(event)
+			require.Len(t, destinations, 1)
+			assert.Equal(t, tt.target, destinations[0].Target())
+			assert.Equal(t, tt.token, routes.Token)
+		})
+	}
+
+	assert.Equal(t, []string{"secret", "brand-a-secret"}, config.Tokens())
+}
+
+func TestConfig_Style(t *testing.T) {
+	config, err := routing.Parse([]byte(tenantsConfig))
+	require.NoError(t, err)
+	tenant := &config.Tenants["brand-a"].Config
+
+	event, err := webhook.ParseEvent([]byte(`{"name": "domain.create"}`))
+	require.NoError(t, err)
+	style := tenant.Style(event)
+	assert.Equal(t, "https://dnsimple.brand-a.test", style.DNSimpleURL)
+	assert.Equal(t, "{{.actor.pretty}} changed {{.domain}}", style.Template.String())
+
+	event, err = webhook.ParseEvent([]byte(`{"name": "zone_record.create"}`))
+	require.NoError(t, err)
+	assert.Equal(t, "{{.text}}", tenant.Style(event).Template.String())
+
+	assert.Empty(t, config.Style(event))
+}
+
+func TestParse_InvalidTenants(t *testing.T) {
+	_, err := routing.Parse([]byte(`
+token: secret
+destinations:
+  ops:
+    type: slack
+    url: https://hooks.slack.com/services/T1/B1/ops
+tenants:
+  brand-a:
+    accounts: ["1010"]
+    token: secret
+    dnsimple_url: dnsimple.brand-a.test
+    default: [ops]
+    templates:
+      - text: "{{.actor.pretty"
+  brand-b:
+    accounts: ["1010"]
+    tenants:
+      nested:
+        accounts: ["3030"]
+  brand-c: {}
+`))
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "tenants.brand-a: token: must differ from the top-level token")
+	assert.Contains(t, err.Error(), `tenants.brand-a: default: unknown destination "ops"`)
+	assert.Contains(t, err.Error(), `tenants.brand-a: dnsimple_url: "dnsimple.brand-a.test" is not an HTTP(S) URL`)
+	assert.Contains(t, err.Error(), "tenants.brand-a: templates[0]: text: ")
+	assert.Contains(t, err.Error(), `tenants.brand-b: accounts: "1010" is also an account of the tenant "brand-a"`)
+	assert.Contains(t, err.Error(), "tenants.brand-b: tenants: not allowed in a tenant")
+	assert.Contains(t, err.Error(), "tenants.brand-c: accounts: at least one account is required")
+}
@@ -0,0 +1,93 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/dnsimple/strillone/internal/service"
+)
+
+// maxDigestLines is the number of events listed in a digest.
+const maxDigestLines = 20
+
+// windowRetention is how long the ended maintenance windows are kept.
+const windowRetention = 7 * 24 * time.Hour
+
+// Flush posts the digests due at now, one message per destination and
+// period. The events of the digests that could not be posted are kept, and
+// posted by the next flush.
+func (s *Store) Flush(ctx context.Context, now time.Time, notify service.NotifyFunc) error {
+	items, err := s.Due(now)
+	if err != nil {
+		return err
+	}
+
+	type digestKey struct {
+		destination string
+		label       string
+		due         time.Time
+	}
+	var keys []digestKey
+	digests := make(map[digestKey][]DigestItem)
+	for _, item := range items {
+		k := digestKey{item.Destination, item.Label, item.Due.UTC()}
+		if _, ok := digests[k]; !ok {
+			keys = append(keys, k)
+		}
+		digests[k] = append(digests[k], item)
+	}
+
+	var errs []error
+	for _, k := range keys {
+		if err := notify(ctx, k.destination, digestText(k.label, digests[k])); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := s.Remove(digests[k]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Run flushes the due digests every interval, and prunes the old
+// maintenance windows, until ctx is done.
+func (s *Store) Run(ctx context.Context, interval time.Duration, notify service.NotifyFunc) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := s.Flush(ctx, now, notify); err != nil {
+				log.Printf("Error posting digests: %v\n", err)
+			}
+			if err := s.Prune(now.Add(-windowRetention)); err != nil {
+				log.Printf("Error pruning maintenance windows: %v\n", err)
+			}
+		}
+	}
+}
+
+func digestText(label string, items []DigestItem) string {
+	var b strings.Builder
+	noun := "events"
+	if len(items) == 1 {
+		noun = "event"
+	}
+	fmt.Fprintf(&b, "Digest of %d %s deferred during %s:", len(items), noun, label)
+	for i, item := range items {
+		if i == maxDigestLines {
+			fmt.Fprintf(&b, "\n…and %d more", len(items)-maxDigestLines)
+			break
+		}
+		fmt.Fprintf(&b, "\n• %s", item.Text)
+	}
+	return b.String()
+}
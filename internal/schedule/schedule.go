@@ -0,0 +1,203 @@
+// Package schedule implements the time-based delivery rules: the quiet hours
+// of the destinations, and the maintenance windows created through the admin
+// API. During a period, the events are either suppressed, deferred into a
+// digest, or delivered silently.
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Mode is what happens to the events during a period.
+type Mode string
+
+const (
+	// Suppress drops the events.
+	Suppress Mode = "suppress"
+	// Digest defers the events into a single message, posted once the
+	// period is over.
+	Digest Mode = "digest"
+	// Silent delivers the events quietly, without mentions.
+	Silent Mode = "silent"
+)
+
+// strictness orders the modes, so that the strictest applies when periods
+// overlap.
+var strictness = map[Mode]int{Silent: 1, Digest: 2, Suppress: 3}
+
+func (m Mode) validate() error {
+	if _, ok := strictness[m]; !ok {
+		return fmt.Errorf("mode: unknown mode %q, expected %s, %s or %s", m, Suppress, Digest, Silent)
+	}
+	return nil
+}
+
+// Period is an active quiet hours period or maintenance window.
+type Period struct {
+	// Label describes the period in the digests, such as "quiet hours".
+	Label string
+	Mode  Mode
+	// End is when the period ends, and its digest is posted.
+	End time.Time
+}
+
+// Strictest returns the period with the strictest mode, or nil.
+func Strictest(periods []*Period) *Period {
+	var strictest *Period
+	for _, period := range periods {
+		if strictest == nil || strictness[period.Mode] > strictness[strictest.Mode] {
+			strictest = period
+		}
+	}
+	return strictest
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// QuietHours is a daily period of a destination, such as 22:00 to 07:00 in
+// Europe/Rome.
+type QuietHours struct {
+	// From and To are the local times of the period, as HH:MM. The period
+	// ends the next day when To is before From.
+	From string `yaml:"from"`
+	To   string `yaml:"to"`
+	// Timezone is the IANA name of the timezone, UTC when empty.
+	Timezone string `yaml:"timezone"`
+	// Days are the days the period starts on, such as [sat, sun]. Every day
+	// when empty.
+	Days []string `yaml:"days"`
+	// Mode is what happens to the events, silent when empty.
+	Mode Mode `yaml:"mode"`
+
+	from, to time.Duration
+	location *time.Location
+}
+
+// Validate checks the quiet hours, and prepares them to be evaluated.
+func (q *QuietHours) Validate() []error {
+	var errs []error
+
+	var err error
+	if q.from, err = parseClock(q.From); err != nil {
+		errs = append(errs, fmt.Errorf("from: %w", err))
+	}
+	if q.to, err = parseClock(q.To); err != nil {
+		errs = append(errs, fmt.Errorf("to: %w", err))
+	}
+	if q.location, err = time.LoadLocation(q.Timezone); err != nil {
+		errs = append(errs, fmt.Errorf("timezone: unknown timezone %q", q.Timezone))
+	}
+	for _, day := range q.Days {
+		if _, ok := weekdays[strings.ToLower(day)]; !ok {
+			errs = append(errs, fmt.Errorf("days: unknown day %q, expected mon, tue, wed, thu, fri, sat or sun", day))
+		}
+	}
+	if q.Mode == "" {
+		q.Mode = Silent
+	}
+	if err := q.Mode.validate(); err != nil {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// Active returns the period active at now, or nil.
+func (q *QuietHours) Active(now time.Time) *Period {
+	local := now.In(q.location)
+	midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, q.location)
+
+	// The period active now started either today or yesterday.
+	for _, day := range []time.Time{midnight, midnight.AddDate(0, 0, -1)} {
+		if !q.startsOn(day.Weekday()) {
+			continue
+		}
+		start := at(day, q.from)
+		end := at(day, q.to)
+		if q.to <= q.from {
+			end = at(day.AddDate(0, 0, 1), q.to)
+		}
+		if !local.Before(start) && local.Before(end) {
+			return &Period{Label: "quiet hours", Mode: q.Mode, End: end}
+		}
+	}
+	return nil
+}
+
+func (q *QuietHours) startsOn(weekday time.Weekday) bool {
+	return len(q.Days) == 0 || slices.ContainsFunc(q.Days, func(day string) bool {
+		return weekdays[strings.ToLower(day)] == weekday
+	})
+}
+
+// at returns the local time of day, which is not always midnight plus
+// clock on the days the clocks change.
+func at(day time.Time, clock time.Duration) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), 0, int(clock/time.Minute), 0, 0, day.Location())
+}
+
+func parseClock(value string) (time.Duration, error) {
+	clock, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", value)
+	}
+	return time.Duration(clock.Hour())*time.Hour + time.Duration(clock.Minute())*time.Minute, nil
+}
+
+// Window is a maintenance window.
+type Window struct {
+	// ID is assigned by the store.
+	ID   uint64 `json:"id"`
+	Name string `json:"name"`
+	// Destinations are globs of the names or the targets of the destinations,
+	// such as "ops" or "slack/T00000000/*/*". All the destinations when empty.
+	Destinations []string  `json:"destinations,omitempty"`
+	StartsAt     time.Time `json:"starts_at"`
+	EndsAt       time.Time `json:"ends_at"`
+	Mode         Mode      `json:"mode"`
+}
+
+// Validate checks the window.
+func (w *Window) Validate() error {
+	var errs []error
+	if w.Name == "" {
+		errs = append(errs, errors.New("name: required"))
+	}
+	if w.StartsAt.IsZero() || w.EndsAt.IsZero() {
+		errs = append(errs, errors.New("starts_at and ends_at: required"))
+	} else if !w.EndsAt.After(w.StartsAt) {
+		errs = append(errs, errors.New("ends_at: must be after starts_at"))
+	}
+	for _, pattern := range w.Destinations {
+		if _, err := path.Match(pattern, ""); err != nil {
+			errs = append(errs, fmt.Errorf("destinations: invalid pattern %q", pattern))
+		}
+	}
+	if err := w.Mode.validate(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// Active returns the period of the window if it is active at now for the
+// destination with the given name and target, or nil.
+func (w *Window) Active(now time.Time, name, target string) *Period {
+	if now.Before(w.StartsAt) || !now.Before(w.EndsAt) {
+		return nil
+	}
+	if len(w.Destinations) > 0 && !slices.ContainsFunc(w.Destinations, func(pattern string) bool {
+		matchName, _ := path.Match(pattern, name)
+		matchTarget, _ := path.Match(pattern, target)
+		return (name != "" && matchName) || matchTarget
+	}) {
+		return nil
+	}
+	return &Period{Label: fmt.Sprintf("maintenance window %q", w.Name), Mode: w.Mode, End: w.EndsAt}
+}
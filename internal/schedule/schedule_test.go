@@ -0,0 +1,141 @@
+package schedule_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dnsimple/strillone/internal/schedule"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuietHours_Active(t *testing.T) {
+	rome, err := time.LoadLocation("Europe/Rome")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		hours  schedule.QuietHours
+		now    time.Time
+		active bool
+		end    time.Time
+	}{
+		{
+			name:   "overnight, before midnight",
+			hours:  schedule.QuietHours{From: "22:00", To: "07:00", Timezone: "Europe/Rome"},
+			now:    time.Date(2026, 10, 19, 21, 30, 0, 0, time.UTC), // 23:30 in Rome
+			active: true,
+			end:    time.Date(2026, 10, 20, 7, 0, 0, 0, rome),
+		},
+		{
+			name:   "overnight, after midnight",
+			hours:  schedule.QuietHours{From: "22:00", To: "07:00", Timezone: "Europe/Rome"},
+			now:    time.Date(2026, 10, 20, 6, 59, 0, 0, rome),
+			active: true,
+			end:    time.Date(2026, 10, 20, 7, 0, 0, 0, rome),
+		},
+		{
+			name:  "overnight, ended",
+			hours: schedule.QuietHours{From: "22:00", To: "07:00", Timezone: "Europe/Rome"},
+			now:   time.Date(2026, 10, 20, 7, 0, 0, 0, rome),
+		},
+		{
+			name:   "same day",
+			hours:  schedule.QuietHours{From: "12:00", To: "14:00"},
+			now:    time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC),
+			active: true,
+			end:    time.Date(2026, 10, 19, 14, 0, 0, 0, time.UTC),
+		},
+		{
+			name:   "started on a listed day",
+			hours:  schedule.QuietHours{From: "20:00", To: "08:00", Days: []string{"Sat"}},
+			now:    time.Date(2026, 10, 18, 7, 0, 0, 0, time.UTC), // Sunday morning
+			active: true,
+			end:    time.Date(2026, 10, 18, 8, 0, 0, 0, time.UTC),
+		},
+		{
+			name:  "started on another day",
+			hours: schedule.QuietHours{From: "20:00", To: "08:00", Days: []string{"sat"}},
+			now:   time.Date(2026, 10, 19, 7, 0, 0, 0, time.UTC), // Monday morning
+		},
+		{
+			name:   "the day the clocks change",
+			hours:  schedule.QuietHours{From: "22:00", To: "07:00", Timezone: "Europe/Rome"},
+			now:    time.Date(2026, 10, 25, 6, 30, 0, 0, rome),
+			active: true,
+			end:    time.Date(2026, 10, 25, 7, 0, 0, 0, rome),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Empty(t, tt.hours.Validate())
+
+			period := tt.hours.Active(tt.now)
+			if !tt.active {
+				assert.Nil(t, period)
+				return
+			}
+			require.NotNil(t, period)
+			assert.Equal(t, schedule.Silent, period.Mode)
+			assert.True(t, tt.end.Equal(period.End), "ends at %s, expected %s", period.End, tt.end)
+		})
+	}
+}
+
+func TestQuietHours_Validate(t *testing.T) {
+	hours := schedule.QuietHours{From: "25:00", To: "7am", Timezone: "Mars/Olympus", Days: []string{"someday"}, Mode: "snooze"}
+
+	errs := hours.Validate()
+
+	require.Len(t, errs, 5)
+	assert.EqualError(t, errs[0], `from: invalid time "25:00", expected HH:MM`)
+	assert.EqualError(t, errs[1], `to: invalid time "7am", expected HH:MM`)
+	assert.EqualError(t, errs[2], `timezone: unknown timezone "Mars/Olympus"`)
+	assert.EqualError(t, errs[3], `days: unknown day "someday", expected mon, tue, wed, thu, fri, sat or sun`)
+	assert.EqualError(t, errs[4], `mode: unknown mode "snooze", expected suppress, digest or silent`)
+}
+
+func TestWindow_Active(t *testing.T) {
+	start := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	window := schedule.Window{
+		Name:         "migration",
+		Destinations: []string{"ops", "slack/T1/*/*"},
+		StartsAt:     start,
+		EndsAt:       start.Add(time.Hour),
+		Mode:         schedule.Digest,
+	}
+	require.NoError(t, window.Validate())
+
+	period := window.Active(start, "ops", "slack/T9/B9/ops")
+	require.NotNil(t, period)
+	assert.Equal(t, `maintenance window "migration"`, period.Label)
+	assert.Equal(t, start.Add(time.Hour), period.End)
+
+	assert.NotNil(t, window.Active(start, "", "slack/T1/B1/legacy"))
+	assert.Nil(t, window.Active(start, "billing", "slack/T2/B2/billing"))
+	assert.Nil(t, window.Active(start.Add(-time.Second), "ops", ""))
+	assert.Nil(t, window.Active(start.Add(time.Hour), "ops", ""))
+
+	window.Destinations = nil
+	assert.NotNil(t, window.Active(start, "billing", "slack/T2/B2/billing"))
+}
+
+func TestWindow_Validate(t *testing.T) {
+	start := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	window := schedule.Window{Destinations: []string{"[ops"}, StartsAt: start, EndsAt: start, Mode: "later"}
+
+	assert.EqualError(t, window.Validate(), `name: required
+ends_at: must be after starts_at
+destinations: invalid pattern "[ops"
+mode: unknown mode "later", expected suppress, digest or silent`)
+}
+
+func TestStrictest(t *testing.T) {
+	silent := &schedule.Period{Mode: schedule.Silent}
+	digest := &schedule.Period{Mode: schedule.Digest}
+	suppress := &schedule.Period{Mode: schedule.Suppress}
+
+	assert.Nil(t, schedule.Strictest(nil))
+	assert.Equal(t, digest, schedule.Strictest([]*schedule.Period{silent, digest}))
+	assert.Equal(t, suppress, schedule.Strictest([]*schedule.Period{silent, suppress, digest}))
+}
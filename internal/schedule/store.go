@@ -0,0 +1,202 @@
+package schedule
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	windowsBucket = []byte("windows")
+	digestsBucket = []byte("digests")
+)
+
+// ErrNotFound is returned for an unknown maintenance window.
+var ErrNotFound = errors.New("maintenance window not found")
+
+// DigestItem is an event deferred into the digest of a destination.
+type DigestItem struct {
+	ID          uint64    `json:"id"`
+	Destination string    `json:"destination"`
+	Label       string    `json:"label"`
+	Due         time.Time `json:"due"`
+	Text        string    `json:"text"`
+}
+
+// Store keeps the maintenance windows and the deferred events in an
+// embedded bbolt database.
+type Store struct {
+	db *bolt.DB
+}
+
+// Open opens or creates the schedule database at path.
+func Open(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("opening schedule %s: %w", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{windowsBucket, digestsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("initializing schedule %s: %w", path, err)
+	}
+
+	return &Store{db: db}, nil
+}
+
+// AddWindow persists a new maintenance window, and returns it with its ID
+// assigned.
+func (s *Store) AddWindow(window Window) (Window, error) {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(windowsBucket)
+
+		id, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		window.ID = id
+		return put(bucket, id, window)
+	})
+	return window, err
+}
+
+// Windows returns the maintenance windows, in creation order.
+func (s *Store) Windows() ([]Window, error) {
+	windows := []Window{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(windowsBucket).ForEach(func(_, v []byte) error {
+			var window Window
+			if err := json.Unmarshal(v, &window); err != nil {
+				return err
+			}
+			windows = append(windows, window)
+			return nil
+		})
+	})
+	return windows, err
+}
+
+// DeleteWindow removes a maintenance window. The events already deferred
+// into its digest are still posted.
+func (s *Store) DeleteWindow(id uint64) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(windowsBucket)
+		if bucket.Get(key(id)) == nil {
+			return ErrNotFound
+		}
+		return bucket.Delete(key(id))
+	})
+}
+
+// Active returns the periods of the maintenance windows active at now for
+// the destination with the given name and target.
+func (s *Store) Active(now time.Time, name, target string) ([]*Period, error) {
+	windows, err := s.Windows()
+	if err != nil {
+		return nil, err
+	}
+
+	var periods []*Period
+	for _, window := range windows {
+		if period := window.Active(now, name, target); period != nil {
+			periods = append(periods, period)
+		}
+	}
+	return periods, nil
+}
+
+// Defer adds an event to the digest of a destination.
+func (s *Store) Defer(item DigestItem) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(digestsBucket)
+
+		id, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		item.ID = id
+		return put(bucket, id, item)
+	})
+}
+
+// Due returns the deferred events whose digest is due at now, in arrival order.
+func (s *Store) Due(now time.Time) ([]DigestItem, error) {
+	var items []DigestItem
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(digestsBucket).ForEach(func(_, v []byte) error {
+			var item DigestItem
+			if err := json.Unmarshal(v, &item); err != nil {
+				return err
+			}
+			if !item.Due.After(now) {
+				items = append(items, item)
+			}
+			return nil
+		})
+	})
+	return items, err
+}
+
+// Remove removes the deferred events once posted.
+func (s *Store) Remove(items []DigestItem) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(digestsBucket)
+		for _, item := range items {
+			if err := bucket.Delete(key(item.ID)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Prune removes the maintenance windows that ended before t.
+func (s *Store) Prune(t time.Time) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(windowsBucket).Cursor()
+		for k, v := cursor.First(); k != nil; k, v = cursor.Next() {
+			var window Window
+			if err := json.Unmarshal(v, &window); err != nil {
+				return err
+			}
+			if window.EndsAt.Before(t) {
+				if err := cursor.Delete(); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// Close closes the database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+func put(bucket *bolt.Bucket, id uint64, value any) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return bucket.Put(key(id), data)
+}
+
+// key encodes the ID in big endian, so that the keys sort in arrival order.
+func key(id uint64) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, id)
+	return k
+}
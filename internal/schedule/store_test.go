@@ -0,0 +1,102 @@
+package schedule_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dnsimple/strillone/internal/schedule"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func openStore(t *testing.T) *schedule.Store {
+	t.Helper()
+
+	store, err := schedule.Open(filepath.Join(t.TempDir(), "schedule.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestStore_Windows(t *testing.T) {
+	store := openStore(t)
+	now := time.Now()
+
+	window, err := store.AddWindow(schedule.Window{Name: "migration", StartsAt: now.Add(-time.Minute), EndsAt: now.Add(time.Hour), Mode: schedule.Silent})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), window.ID)
+	_, err = store.AddWindow(schedule.Window{Name: "next week", StartsAt: now.Add(7 * 24 * time.Hour), EndsAt: now.Add(8 * 24 * time.Hour), Mode: schedule.Suppress})
+	require.NoError(t, err)
+
+	windows, err := store.Windows()
+	require.NoError(t, err)
+	require.Len(t, windows, 2)
+	assert.Equal(t, "migration", windows[0].Name)
+
+	periods, err := store.Active(now, "ops", "slack/T1/B1/ops")
+	require.NoError(t, err)
+	require.Len(t, periods, 1)
+	assert.Equal(t, schedule.Silent, periods[0].Mode)
+
+	require.NoError(t, store.DeleteWindow(window.ID))
+	assert.ErrorIs(t, store.DeleteWindow(window.ID), schedule.ErrNotFound)
+
+	require.NoError(t, store.Prune(now.Add(30*24*time.Hour)))
+	windows, err = store.Windows()
+	require.NoError(t, err)
+	assert.Empty(t, windows)
+}
+
+func TestStore_Flush(t *testing.T) {
+	store := openStore(t)
+	now := time.Now()
+
+	for i := range 25 {
+		require.NoError(t, store.Defer(schedule.DigestItem{Destination: "slack/T1/B1/ops", Label: `maintenance window "migration"`, Due: now, Text: fmt.Sprintf("event %d", i)}))
+	}
+	require.NoError(t, store.Defer(schedule.DigestItem{Destination: "slack/T1/B2/dev", Label: "quiet hours", Due: now, Text: "dev event"}))
+	require.NoError(t, store.Defer(schedule.DigestItem{Destination: "slack/T1/B2/dev", Label: "quiet hours", Due: now.Add(time.Hour), Text: "later event"}))
+
+	posted := map[string]string{}
+	notify := func(_ context.Context, destination, text string) error {
+		posted[destination] = text
+		return nil
+	}
+	require.NoError(t, store.Flush(context.Background(), now, notify))
+
+	require.Len(t, posted, 2)
+	assert.Equal(t, "Digest of 1 event deferred during quiet hours:\n• dev event", posted["slack/T1/B2/dev"])
+	lines := strings.Split(posted["slack/T1/B1/ops"], "\n")
+	require.Len(t, lines, 22)
+	assert.Equal(t, `Digest of 25 events deferred during maintenance window "migration":`, lines[0])
+	assert.Equal(t, "• event 0", lines[1])
+	assert.Equal(t, "…and 5 more", lines[21])
+
+	due, err := store.Due(now)
+	require.NoError(t, err)
+	assert.Empty(t, due)
+	due, err = store.Due(now.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Len(t, due, 1)
+}
+
+func TestStore_FlushError(t *testing.T) {
+	store := openStore(t)
+	now := time.Now()
+	require.NoError(t, store.Defer(schedule.DigestItem{Destination: "slack/T1/B1/ops", Label: "quiet hours", Due: now, Text: "event"}))
+
+	err := store.Flush(context.Background(), now, func(context.Context, string, string) error {
+		return errors.New("unavailable")
+	})
+	assert.EqualError(t, err, "unavailable")
+
+	// The digest is posted by the next flush.
+	due, err := store.Due(now)
+	require.NoError(t, err)
+	assert.Len(t, due, 1)
+}
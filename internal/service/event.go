@@ -0,0 +1,98 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/dnsimple/dnsimple-go/v7/dnsimple/webhook"
+)
+
+// DomainName returns the name of the domain or zone the event is about, or
+// the common name of the certificate, or an empty string for the events
+// that are not about a domain.
+func DomainName(e *webhook.Event) string {
+	switch data := e.GetData().(type) {
+	case *webhook.CertificateEventData:
+		if data.Certificate != nil {
+			return data.Certificate.CommonName
+		}
+	case *webhook.DomainEventData:
+		if data.Domain != nil {
+			return data.Domain.Name
+		}
+	case *webhook.DomainTransferLockEventData:
+		if data.Domain != nil {
+			return data.Domain.Name
+		}
+	case *webhook.DomainRegistrantChangeEventData:
+		if data.Domain != nil {
+			return data.Domain.Name
+		}
+	case *webhook.WhoisPrivacyEventData:
+		if data.Domain != nil {
+			return data.Domain.Name
+		}
+	case *webhook.DNSSECEventData:
+		if data.Zone != nil {
+			return data.Zone.Name
+		}
+	case *webhook.ZoneEventData:
+		if data.Zone != nil {
+			return data.Zone.Name
+		}
+	case *webhook.ZoneRecordEventData:
+		if data.ZoneRecord != nil {
+			return data.ZoneRecord.ZoneID
+		}
+	}
+	return ""
+}
+
+// PartitionKey returns the key of the events that must be delivered in
+// order: the events of an account about the same domain or zone share a key.
+// The key is empty when the event has no account.
+func PartitionKey(e *webhook.Event) string {
+	if e.Account == nil || e.Account.ID == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d/%s", e.Account.ID, DomainName(e))
+}
+
+// EventView returns a view of the event as plain values, such as the
+// variables of the routing expressions and the data of the message templates.
+func EventView(e *webhook.Event) (map[string]any, error) {
+	var payload struct {
+		Data map[string]any `json:"data"`
+	}
+	if len(e.GetPayload()) > 0 {
+		if err := json.Unmarshal(e.GetPayload(), &payload); err != nil {
+			return nil, err
+		}
+	}
+	if payload.Data == nil {
+		payload.Data = map[string]any{}
+	}
+
+	account := map[string]any{}
+	if e.Account != nil {
+		account["id"] = e.Account.ID
+		account["display"] = e.Account.Display
+		account["identifier"] = e.Account.Identifier
+	}
+	actor := map[string]any{}
+	if e.Actor != nil {
+		actor["id"] = e.Actor.ID
+		actor["entity"] = e.Actor.Entity
+		actor["pretty"] = e.Actor.Pretty
+	}
+
+	return map[string]any{
+		"name":       e.Name,
+		"request_id": e.RequestID,
+		"domain":     strings.ToLower(DomainName(e)),
+		"account":    account,
+		"actor":      actor,
+		"data":       payload.Data,
+	}, nil
+}
@@ -0,0 +1,65 @@
+package service_test
+
+import (
+	"testing"
+
+	"github.com/dnsimple/dnsimple-go/v7/dnsimple/webhook"
+	xservice "github.com/dnsimple/strillone/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPartitionKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		domain  string
+		key     string
+	}{
+		{
+			name:    "domain",
+			payload: `{"name": "domain.create", "account": {"id": 1}, "data": {"domain": {"name": "example.com"}}}`,
+			domain:  "example.com",
+			key:     "1/example.com",
+		},
+		{
+			name:    "zone record",
+			payload: `{"name": "zone_record.update", "account": {"id": 1}, "data": {"zone_record": {"zone_id": "example.com"}}}`,
+			domain:  "example.com",
+			key:     "1/example.com",
+		},
+		{
+			name:    "certificate",
+			payload: `{"name": "certificate.issue", "account": {"id": 1}, "data": {"certificate": {"common_name": "www.example.com"}}}`,
+			domain:  "www.example.com",
+			key:     "1/www.example.com",
+		},
+		{
+			name:    "contact",
+			payload: `{"name": "contact.create", "account": {"id": 1}, "data": {"contact": {"id": 2}}}`,
+			domain:  "",
+			key:     "1/",
+		},
+		{
+			name:    "no account",
+			payload: `{"name": "zone.create", "data": {"zone": {"name": "example.com"}}}`,
+			domain:  "example.com",
+			key:     "",
+		},
+		{
+			name:    "no data",
+			payload: `{"name": "zone_record.create", "account": {"id": 1}}`,
+			domain:  "",
+			key:     "1/",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, err := webhook.ParseEvent([]byte(tt.payload))
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.domain, xservice.DomainName(event))
+			assert.Equal(t, tt.key, xservice.PartitionKey(event))
+		})
+	}
+}
@@ -9,39 +9,76 @@ import (
 )
 
 // Message formats the event into a text message suitable for being sent to a messaging service.
-func Message(s MessagingService, e *webhook.Event) (text string) {
+func Message(s MessagingService, e *webhook.Event) string {
+	return message(s, e, config.Config.DNSimpleURL)
+}
+
+// message formats the event with the links to the DNSimple app at baseURL.
+func message(s MessagingService, e *webhook.Event, baseURL string) (text string) {
+	fmtURL := func(path string, a ...interface{}) string {
+		return fmt.Sprintf(baseURL+path, a...)
+	}
+
+	// Partial payloads must never crash the formatter: missing pieces are
+	// replaced with zero values, and any case that lacks the data it needs
+	// leaves text empty so that the generic fallback below is used.
 	account := e.Account
-	prefix := fmt.Sprintf("[%v] %v", s.FormatLink(account.Display, FmtURL("/a/%d/account", account.ID)), e.Actor.Pretty)
+	if account == nil {
+		account = &webhook.Account{}
+	}
+	actor := e.Actor
+	if actor == nil {
+		actor = &webhook.Actor{}
+	}
+	prefix := fmt.Sprintf("[%v] %v", s.FormatLink(account.Display, fmtURL("/a/%d/account", account.ID)), actor.Pretty)
 
 	switch data := e.GetData().(type) {
 	case *webhook.AccountMembershipEventData:
-		membersLink := s.FormatLink(fmt.Sprintf("%d", data.Account.ID), FmtURL("/a/%d/account/members", data.Account.ID))
+		if data.Account == nil {
+			break
+		}
+		membersLink := s.FormatLink(fmt.Sprintf("%d", data.Account.ID), fmtURL("/a/%d/account/members", data.Account.ID))
 		switch e.Name {
 		case "account.user_invite":
-			text = fmt.Sprintf("%s invited %s to account %s", e.Actor.Pretty, data.AccountInvitation.Email, membersLink)
+			if data.AccountInvitation == nil {
+				break
+			}
+			text = fmt.Sprintf("%s invited %s to account %s", actor.Pretty, data.AccountInvitation.Email, membersLink)
 		case "account.user_invitation_accept":
-			text = fmt.Sprintf("%s accepted invitation to account %s", e.Actor.Pretty, membersLink)
+			text = fmt.Sprintf("%s accepted invitation to account %s", actor.Pretty, membersLink)
 		case "account.user_invitation_revoke":
-			text = fmt.Sprintf("%s rejected invitation to account %s", e.Actor.Pretty, membersLink)
+			text = fmt.Sprintf("%s rejected invitation to account %s", actor.Pretty, membersLink)
 		case "account.user_remove":
-			text = fmt.Sprintf("%s removed %s from account %s", e.Actor.Pretty, data.User.Email, membersLink)
+			if data.User == nil {
+				break
+			}
+			text = fmt.Sprintf("%s removed %s from account %s", actor.Pretty, data.User.Email, membersLink)
 		default:
 			text = fmt.Sprintf("%s performed %s", prefix, e.Name)
 		}
 
 	case *webhook.AccountSsoEventData:
-		membersLink := s.FormatLink(fmt.Sprintf("%d", data.Account.ID), FmtURL("/a/%d/account/members", data.Account.ID))
+		if data.Account == nil {
+			break
+		}
+		membersLink := s.FormatLink(fmt.Sprintf("%d", data.Account.ID), fmtURL("/a/%d/account/members", data.Account.ID))
 		switch e.Name {
 		case "account.sso_user_add":
-			text = fmt.Sprintf("%s added %s to account %s via SSO", e.Actor.Pretty, data.User.Email, membersLink)
+			if data.User == nil {
+				break
+			}
+			text = fmt.Sprintf("%s added %s to account %s via SSO", actor.Pretty, data.User.Email, membersLink)
 		default:
 			text = fmt.Sprintf("%s performed %s", prefix, e.Name)
 		}
 
 	case *webhook.CertificateEventData:
+		if data.Certificate == nil {
+			break
+		}
 		certificate := data.Certificate
 		certificateDisplay := certificate.CommonName
-		certificateLink := s.FormatLink(certificateDisplay, FmtURL("/a/%d/domains/%d/certificates/%d", account.ID, certificate.DomainID, certificate.ID))
+		certificateLink := s.FormatLink(certificateDisplay, fmtURL("/a/%d/domains/%d/certificates/%d", account.ID, certificate.DomainID, certificate.ID))
 		switch e.Name {
 		case "certificate.issue":
 			text = fmt.Sprintf("%s issued the certificate %s", prefix, certificateLink)
@@ -52,8 +89,11 @@ func Message(s MessagingService, e *webhook.Event) (text string) {
 		}
 
 	case *webhook.ContactEventData:
+		if data.Contact == nil {
+			break
+		}
 		contactDisplay := fmt.Sprintf("%s %s", data.Contact.FirstName, data.Contact.LastName)
-		contactLink := s.FormatLink(contactDisplay, FmtURL("/a/%d/contacts/%d", account.ID, data.Contact.ID))
+		contactLink := s.FormatLink(contactDisplay, fmtURL("/a/%d/contacts/%d", account.ID, data.Contact.ID))
 		switch e.Name {
 		case "contact.create":
 			text = fmt.Sprintf("%s created the contact %s", prefix, contactLink)
@@ -66,8 +106,11 @@ func Message(s MessagingService, e *webhook.Event) (text string) {
 		}
 
 	case *webhook.DNSSECEventData:
+		if data.Zone == nil {
+			break
+		}
 		zoneDisplay := data.Zone.Name
-		zoneLink := s.FormatLink(zoneDisplay, FmtURL("/a/%d/domains/%s", account.ID, data.Zone.Name))
+		zoneLink := s.FormatLink(zoneDisplay, fmtURL("/a/%d/domains/%s", account.ID, data.Zone.Name))
 		switch e.Name {
 		case "dnssec.create":
 			text = fmt.Sprintf("%s enabled DNSSEC for the zone %s", prefix, zoneLink)
@@ -82,8 +125,11 @@ func Message(s MessagingService, e *webhook.Event) (text string) {
 		}
 
 	case *webhook.DomainEventData:
+		if data.Domain == nil {
+			break
+		}
 		domainDisplay := data.Domain.Name
-		domainLink := s.FormatLink(domainDisplay, FmtURL("/a/%d/domains/%s", account.ID, data.Domain.Name))
+		domainLink := s.FormatLink(domainDisplay, fmtURL("/a/%d/domains/%s", account.ID, data.Domain.Name))
 		switch e.Name {
 		case "domain.auto_renewal_enable":
 			text = fmt.Sprintf("%s enabled auto-renewal for the domain %s", prefix, domainLink)
@@ -98,9 +144,15 @@ func Message(s MessagingService, e *webhook.Event) (text string) {
 		case "domain.renew":
 			text = fmt.Sprintf("%s renewed the domain %s", prefix, domainLink)
 		case "domain.delegation_change":
+			if data.Delegation == nil {
+				break
+			}
 			servers := strings.Join(*data.Delegation, ", ")
 			text = fmt.Sprintf("%s changed the delegation for the domain %s to %s", prefix, domainLink, servers)
 		case "domain.registrant_change":
+			if data.Registrant == nil {
+				break
+			}
 			registrant := data.Registrant.Label
 			text = fmt.Sprintf("%s changed the registrant for the domain %s to %s", prefix, domainLink, registrant)
 		case "domain.resolution_enable":
@@ -116,8 +168,11 @@ func Message(s MessagingService, e *webhook.Event) (text string) {
 		}
 
 	case *webhook.DomainTransferLockEventData:
+		if data.Domain == nil {
+			break
+		}
 		domainDisplay := data.Domain.Name
-		domainLink := s.FormatLink(domainDisplay, FmtURL("/a/%d/domains/%s", account.ID, data.Domain.Name))
+		domainLink := s.FormatLink(domainDisplay, fmtURL("/a/%d/domains/%s", account.ID, data.Domain.Name))
 		switch e.Name {
 		case "domain.transfer_lock_enable":
 			text = fmt.Sprintf("%s enabled transfer lock for the domain %s", prefix, domainLink)
@@ -128,10 +183,13 @@ func Message(s MessagingService, e *webhook.Event) (text string) {
 		}
 
 	case *webhook.EmailForwardEventData:
+		if data.EmailForward == nil {
+			break
+		}
 		emailforward := data.EmailForward
 		emailforwardDisplay := fmt.Sprintf("%s → %s", emailforward.AliasEmail, emailforward.DestinationEmail)
 		// We don't individual email forwards pages
-		emailforwardLink := s.FormatLink(emailforwardDisplay, FmtURL("/a/%d/domains/%d/email_forwards", account.ID, emailforward.DomainID))
+		emailforwardLink := s.FormatLink(emailforwardDisplay, fmtURL("/a/%d/domains/%d/email_forwards", account.ID, emailforward.DomainID))
 		switch e.Name {
 		case "email_forward.create":
 			text = fmt.Sprintf("%s created the email forward %s", prefix, emailforwardLink)
@@ -144,8 +202,11 @@ func Message(s MessagingService, e *webhook.Event) (text string) {
 		}
 
 	case *webhook.WebhookEventData:
+		if data.Webhook == nil {
+			break
+		}
 		webhookDisplay := data.Webhook.URL
-		webhookLink := s.FormatLink(webhookDisplay, FmtURL("/a/%d/webhooks/%d", account.ID, data.Webhook.ID))
+		webhookLink := s.FormatLink(webhookDisplay, fmtURL("/a/%d/webhooks/%d", account.ID, data.Webhook.ID))
 		switch e.Name {
 		case "webhook.create":
 			text = fmt.Sprintf("%s created the webhook %s", prefix, webhookLink)
@@ -154,8 +215,11 @@ func Message(s MessagingService, e *webhook.Event) (text string) {
 		}
 
 	case *webhook.WhoisPrivacyEventData:
+		if data.Domain == nil {
+			break
+		}
 		domainDisplay := data.Domain.Name
-		domainLink := s.FormatLink(domainDisplay, FmtURL("/a/%d/domains/%s", account.ID, data.Domain.Name))
+		domainLink := s.FormatLink(domainDisplay, fmtURL("/a/%d/domains/%s", account.ID, data.Domain.Name))
 		switch e.Name {
 		case "whois_privacy.disable":
 			text = fmt.Sprintf("%s disabled whois privacy for the domain %s", prefix, domainLink)
@@ -168,8 +232,11 @@ func Message(s MessagingService, e *webhook.Event) (text string) {
 		}
 
 	case *webhook.ZoneEventData:
+		if data.Zone == nil {
+			break
+		}
 		zoneDisplay := data.Zone.Name
-		zoneLink := s.FormatLink(zoneDisplay, FmtURL("/a/%d/domains/%s", account.ID, data.Zone.Name))
+		zoneLink := s.FormatLink(zoneDisplay, fmtURL("/a/%d/domains/%s", account.ID, data.Zone.Name))
 		switch e.Name {
 		case "zone.create":
 			text = fmt.Sprintf("%s created the zone %s", prefix, zoneLink)
@@ -180,8 +247,11 @@ func Message(s MessagingService, e *webhook.Event) (text string) {
 		}
 
 	case *webhook.ZoneRecordEventData:
+		if data.ZoneRecord == nil {
+			break
+		}
 		zoneRecordDisplay := fmt.Sprintf("%s %s.%s %s", data.ZoneRecord.Type, data.ZoneRecord.Name, data.ZoneRecord.ZoneID, data.ZoneRecord.Content)
-		zoneRecordLink := s.FormatLink(zoneRecordDisplay, FmtURL("/a/%d/domains/%s/records/%d", account.ID, data.ZoneRecord.ZoneID, data.ZoneRecord.ID))
+		zoneRecordLink := s.FormatLink(zoneRecordDisplay, fmtURL("/a/%d/domains/%s/records/%d", account.ID, data.ZoneRecord.ZoneID, data.ZoneRecord.ID))
 		switch e.Name {
 		case "zone_record.create":
 			text = fmt.Sprintf("%s created the record %s", prefix, zoneRecordLink)
@@ -195,6 +265,10 @@ func Message(s MessagingService, e *webhook.Event) (text string) {
 		text = fmt.Sprintf("%s performed %s", prefix, e.Name)
 	}
 
+	if text == "" {
+		text = fmt.Sprintf("%s performed %s", prefix, e.Name)
+	}
+
 	return text
 }
 
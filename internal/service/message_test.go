@@ -1,6 +1,7 @@
 package service_test
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"testing"
@@ -32,7 +33,7 @@ func (*TestMessagingService) FormatLink(url, name string) string {
 	return fmt.Sprintf("<%s|%s>", url, name)
 }
 
-func (*TestMessagingService) PostEvent(_ *webhook.Event) (string, error) {
+func (*TestMessagingService) PostEvent(_ context.Context, _ *webhook.Event) (string, error) {
 	return "ok", nil
 }
 
@@ -211,3 +212,52 @@ func Test_Message_ZoneEventData(t *testing.T) {
 func Test_fmtURL(t *testing.T) {
 	assert.Equal(t, "https://dnsimple.com/a/1010/domains/1", xservice.FmtURL("/a/%v/domains/%v", "1010", 1))
 }
+
+func Test_Message_PartialPayload(t *testing.T) {
+	service := NewTestMessagingService("dummyMessagingService")
+
+	t.Run("missing account and actor", func(t *testing.T) {
+		event, err := webhook.ParseEvent([]byte(`{"name": "domain.create", "data": {"domain": {"name": "example.com"}}}`))
+		assert.NoError(t, err)
+
+		result := xservice.Message(service, event)
+		assert.Equal(t, "[<|https://dnsimple.com/a/0/account>]  created the domain <example.com|https://dnsimple.com/a/0/domains/example.com>", result)
+	})
+
+	t.Run("missing delegation", func(t *testing.T) {
+		event, err := webhook.ParseEvent([]byte(`{"name": "domain.delegation_change", "actor": {"pretty": "john.doe@email.com"}, "account": {"id": 1, "display": "User"}, "data": {"domain": {"name": "example.com"}}}`))
+		assert.NoError(t, err)
+
+		result := xservice.Message(service, event)
+		assert.Equal(t, "[<User|https://dnsimple.com/a/1/account>] john.doe@email.com performed domain.delegation_change", result)
+	})
+
+	t.Run("missing data", func(t *testing.T) {
+		event, err := webhook.ParseEvent([]byte(`{"name": "zone_record.create", "actor": {"pretty": "john.doe@email.com"}, "account": {"id": 1, "display": "User"}}`))
+		assert.NoError(t, err)
+
+		result := xservice.Message(service, event)
+		assert.Equal(t, "[<User|https://dnsimple.com/a/1/account>] john.doe@email.com performed zone_record.create", result)
+	})
+}
+
+func FuzzMessage(f *testing.F) {
+	f.Add([]byte(`{"name": "domain.create", "actor": {"pretty": "john.doe@email.com"}, "account": {"id": 1, "display": "User"}, "data": {"domain": {"name": "example.com"}}}`))
+	f.Add([]byte(`{"name": "domain.delegation_change", "data": {"domain": {"name": "example.com"}, "name_servers": null}}`))
+	f.Add([]byte(`{"name": "domain.registrant_change", "data": {"registrant": null}}`))
+	f.Add([]byte(`{"name": "account.user_invite", "data": {"account": {"id": 1}}}`))
+	f.Add([]byte(`{"name": "zone_record.update", "data": {"zone_record": null}}`))
+	f.Add([]byte(`{"name": "certificate.issue", "actor": null, "account": null}`))
+
+	service := NewTestMessagingService("dummyMessagingService")
+	f.Fuzz(func(t *testing.T, payload []byte) {
+		event, err := webhook.ParseEvent(payload)
+		if err != nil {
+			return
+		}
+
+		if result := xservice.Message(service, event); result == "" {
+			t.Errorf("empty message for payload %q", payload)
+		}
+	})
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/dnsimple/dnsimple-go/v7/dnsimple/webhook"
+)
+
+// DeliveryPolicy controls how an event is delivered to a MessagingService.
+//
+// The zero value makes a single attempt without deadline.
+type DeliveryPolicy struct {
+	// MaxAttempts is the number of attempts, including the first one.
+	MaxAttempts int
+	// InitialBackoff is the base delay before the second attempt, doubled
+	// after every attempt and randomized with jitter.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between two attempts.
+	MaxBackoff time.Duration
+	// AttemptTimeout is the deadline of a single attempt.
+	AttemptTimeout time.Duration
+}
+
+// Post posts the event to s, retrying the retryable errors. The error
+// returned after the last attempt is a *DeliveryError.
+func (p DeliveryPolicy) Post(ctx context.Context, s MessagingService, event *webhook.Event) (string, error) {
+	for attempt := 1; ; attempt++ {
+		text, err := p.Attempt(ctx, s, event)
+		if err == nil {
+			return text, nil
+		}
+		if attempt >= p.MaxAttempts || !IsRetryable(err) {
+			return "", &DeliveryError{Attempts: attempt, Err: err}
+		}
+
+		delay := p.Delay(attempt, err)
+		log.Printf("[event:%v] Delivery attempt %d failed, retrying in %v: %v\n", eventRequestID(event), attempt, delay, err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return "", &DeliveryError{Attempts: attempt, Err: err}
+		case <-timer.C:
+		}
+	}
+}
+
+// Attempt makes a single attempt to post the event to s, within AttemptTimeout.
+func (p DeliveryPolicy) Attempt(ctx context.Context, s MessagingService, event *webhook.Event) (string, error) {
+	if p.AttemptTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.AttemptTimeout)
+		defer cancel()
+	}
+	return s.PostEvent(ctx, event)
+}
+
+// Delay returns how long to wait after the given failed attempt. The
+// exponential backoff is randomized between half and all of its value, and
+// never shorter than the delay requested by a rate limited destination.
+func (p DeliveryPolicy) Delay(attempt int, err error) time.Duration {
+	backoff := p.InitialBackoff
+	for i := 1; i < attempt && backoff < p.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if p.MaxBackoff > 0 {
+		backoff = min(backoff, p.MaxBackoff)
+	}
+	if backoff > 0 {
+		backoff = backoff/2 + rand.N(backoff/2+1)
+	}
+
+	var rateLimited *RateLimitedError
+	if errors.As(err, &rateLimited) {
+		backoff = max(backoff, rateLimited.RetryAfter)
+	}
+	return backoff
+}
+
+// DeliveryError is the error of the last attempt to deliver an event.
+type DeliveryError struct {
+	Attempts int
+	Err      error
+}
+
+func (e *DeliveryError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *DeliveryError) Unwrap() error {
+	return e.Err
+}
+
+// RateLimitedError is returned by a MessagingService when the destination
+// asks to retry after a delay.
+type RateLimitedError struct {
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *RateLimitedError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RateLimitedError) Unwrap() error {
+	return e.Err
+}
+
+// Retryable implements the interface checked by IsRetryable.
+func (e *RateLimitedError) Retryable() bool {
+	return true
+}
+
+// IsRetryable reports whether delivering again may succeed. Timeouts,
+// network errors, rate limits and server errors are retryable, other errors
+// such as an invalid or revoked webhook are permanent.
+func IsRetryable(err error) bool {
+	var retryable interface{ Retryable() bool }
+	if errors.As(err, &retryable) {
+		return retryable.Retryable()
+	}
+
+	var statusCoder interface{ HTTPStatusCode() int }
+	if errors.As(err, &statusCoder) {
+		code := statusCoder.HTTPStatusCode()
+		return code == http.StatusTooManyRequests || code == http.StatusRequestTimeout || code >= 500
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
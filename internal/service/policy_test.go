@@ -0,0 +1,109 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/dnsimple/dnsimple-go/v7/dnsimple/webhook"
+	xservice "github.com/dnsimple/strillone/internal/service"
+	"github.com/slack-go/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyService fails with err the first failures attempts.
+type flakyService struct {
+	failures int
+	err      error
+	attempts int
+}
+
+func (*flakyService) FormatLink(url, name string) string {
+	return fmt.Sprintf("<%s|%s>", url, name)
+}
+
+func (s *flakyService) PostEvent(_ context.Context, _ *webhook.Event) (string, error) {
+	s.attempts++
+	if s.attempts <= s.failures {
+		return "", s.err
+	}
+	return "ok", nil
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"server error", slack.StatusCodeError{Code: http.StatusInternalServerError}, true},
+		{"too many requests", slack.StatusCodeError{Code: http.StatusTooManyRequests}, true},
+		{"not found", slack.StatusCodeError{Code: http.StatusNotFound}, false},
+		{"forbidden", slack.StatusCodeError{Code: http.StatusForbidden}, false},
+		{"rate limited", &xservice.RateLimitedError{RetryAfter: time.Second, Err: errors.New("rate limited")}, true},
+		{"deadline", fmt.Errorf("posting: %w", context.DeadlineExceeded), true},
+		{"other", errors.New("missing Slack token"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, xservice.IsRetryable(tt.err))
+		})
+	}
+}
+
+func TestDeliveryPolicy_Delay(t *testing.T) {
+	policy := xservice.DeliveryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	err := errors.New("unavailable")
+
+	for range 100 {
+		delay := policy.Delay(1, err)
+		assert.GreaterOrEqual(t, delay, 50*time.Millisecond)
+		assert.LessOrEqual(t, delay, 100*time.Millisecond)
+
+		delay = policy.Delay(3, err)
+		assert.GreaterOrEqual(t, delay, 200*time.Millisecond)
+		assert.LessOrEqual(t, delay, 400*time.Millisecond)
+
+		delay = policy.Delay(20, err)
+		assert.GreaterOrEqual(t, delay, 500*time.Millisecond)
+		assert.LessOrEqual(t, delay, time.Second)
+	}
+
+	rateLimited := &xservice.RateLimitedError{RetryAfter: 5 * time.Second, Err: err}
+	assert.Equal(t, 5*time.Second, policy.Delay(1, rateLimited))
+}
+
+func TestDeliveryPolicy_Post(t *testing.T) {
+	policy := xservice.DeliveryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+	event := &webhook.Event{RequestID: "1"}
+
+	t.Run("retries", func(t *testing.T) {
+		s := &flakyService{failures: 2, err: slack.StatusCodeError{Code: http.StatusBadGateway}}
+		text, err := policy.Post(context.Background(), s, event)
+		require.NoError(t, err)
+		assert.Equal(t, "ok", text)
+		assert.Equal(t, 3, s.attempts)
+	})
+
+	t.Run("gives up", func(t *testing.T) {
+		s := &flakyService{failures: 3, err: slack.StatusCodeError{Code: http.StatusBadGateway}}
+		_, err := policy.Post(context.Background(), s, event)
+		require.Error(t, err)
+		assert.Equal(t, 3, s.attempts)
+
+		var deliveryErr *xservice.DeliveryError
+		require.ErrorAs(t, err, &deliveryErr)
+		assert.Equal(t, 3, deliveryErr.Attempts)
+	})
+
+	t.Run("permanent error", func(t *testing.T) {
+		s := &flakyService{failures: 1, err: slack.StatusCodeError{Code: http.StatusNotFound}}
+		_, err := policy.Post(context.Background(), s, event)
+		require.Error(t, err)
+		assert.Equal(t, 1, s.attempts)
+	})
+}
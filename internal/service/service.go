@@ -1,26 +1,92 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/dnsimple/dnsimple-go/v7/dnsimple/webhook"
 	"github.com/slack-go/slack"
 )
 
+// httpClient is the client shared by all the publishers.
+var httpClient = http.DefaultClient
+
+// SetHTTPClient replaces the client shared by all the publishers. It must be
+// called before the first delivery.
+func SetHTTPClient(client *http.Client) {
+	httpClient = client
+}
+
 // MessagingService represents a service where the event is published.
 // Some examples are Slack, HipChat, and Campfire.
 type MessagingService interface {
 	FormatLink(name, url string) string
-	PostEvent(event *webhook.Event) (string, error)
+	PostEvent(ctx context.Context, event *webhook.Event) (string, error)
+}
+
+// Style is how an event is presented at its destination.
+type Style struct {
+	// Quiet posts a compact, muted message, for the events nobody needs to act on.
+	Quiet bool `json:"quiet,omitempty"`
+	// Freeze is the name of the change freeze the event happened during, and
+	// escalates the message.
+	Freeze string `json:"freeze,omitempty"`
+	// Mentions are added to the escalated messages, such as "<!here>".
+	Mentions []string `json:"mentions,omitempty"`
+	// DNSimpleURL is the DNSimple app the links point to, DNSIMPLE_URL when
+	// empty.
+	DNSimpleURL string `json:"dnsimple_url,omitempty"`
+	// Template replaces the default message.
+	Template *Template `json:"template,omitempty"`
+}
+
+// NewMessagingService returns the service publishing to the given destination,
+// such as "slack/T00000000/B00000000/XXXXXXXXXXXXXXXXXXXXXXXX", in style.
+func NewMessagingService(destination string, style Style) (MessagingService, error) {
+	kind, target, _ := strings.Cut(destination, "/")
+	switch kind {
+	case "slack":
+		return &SlackService{Token: target, Style: style}, nil
+	default:
+		return nil, fmt.Errorf("unsupported destination %q", destination)
+	}
+}
+
+// NotifyFunc posts a plain text message to a destination, as Notify does.
+type NotifyFunc func(ctx context.Context, destination, text string) error
+
+// Notify posts a plain text notice about Strillone itself to destination.
+func Notify(ctx context.Context, destination, text string) error {
+	kind, target, _ := strings.Cut(destination, "/")
+	switch kind {
+	case "slack":
+		return (&SlackService{Token: target}).PostText(ctx, text)
+	default:
+		return fmt.Errorf("unsupported destination %q", destination)
+	}
+}
+
+// RedactDestination hides the secret part of a destination, so that it can
+// be shown in notices and logs.
+func RedactDestination(destination string) string {
+	i := strings.LastIndex(destination, "/")
+	if i < 0 || strings.Count(destination, "/") < 2 {
+		return destination
+	}
+	return destination[:i+1] + "…"
 }
 
 // SlackService represents the Slack message service.
 type SlackService struct {
 	Token string
+	Style Style
 }
 
 // FormatLink implements MessagingService
@@ -34,15 +100,19 @@ func (s *SlackService) FormatMessage(message string) string {
 }
 
 // PostEvent implements MessagingService
-func (s *SlackService) PostEvent(event *webhook.Event) (string, error) {
+func (s *SlackService) PostEvent(ctx context.Context, event *webhook.Event) (string, error) {
+	if s.Token == "" {
+		return "", errors.New("missing Slack token")
+	}
+
 	eventID := eventRequestID(event)
-	text := Message(s, event)
+	text := s.Style.Message(s, event)
 
 	// Send the webhook to Logs
 	log.Printf("[event:%v] %s", eventID, text)
 
 	// Don't send to Slack
-	if s.Token[0] == '-' {
+	if strings.HasPrefix(s.Token, "-") {
 		return "", nil
 	}
 
@@ -60,15 +130,51 @@ func (s *SlackService) PostEvent(event *webhook.Event) (string, error) {
 		Text:          text,
 		Ts:            json.Number(strconv.FormatInt(time.Now().Unix(), 10)),
 	}
+	switch {
+	case s.Style.Freeze != "":
+		notice := strings.TrimSpace(fmt.Sprintf("%s :rotating_light: Change during the %q freeze", strings.Join(s.Style.Mentions, " "), s.Style.Freeze))
+		attachment.Color = "danger"
+		attachment.Pretext = notice
+		attachment.Fallback = notice + ": " + text
+	case s.Style.Quiet:
+		attachment = slack.Attachment{
+			Color:    "#d0d0d0",
+			Fallback: text,
+			Text:     text,
+			Ts:       attachment.Ts,
+		}
+	}
 	msg := slack.WebhookMessage{
 		Attachments: []slack.Attachment{attachment},
 	}
 
-	err := slack.PostWebhook(slackWebhookURL, &msg)
+	err := slack.PostWebhookCustomHTTPContext(ctx, slackWebhookURL, httpClient, &msg)
 	if err != nil {
 		log.Printf("[event:%v] Error sending to slack: %v\n", eventID, err)
+
+		var rateLimited *slack.RateLimitedError
+		if errors.As(err, &rateLimited) {
+			return "", &RateLimitedError{RetryAfter: rateLimited.RetryAfter, Err: err}
+		}
 		return "", err
 	}
 
 	return text, nil
 }
+
+// PostText posts a plain text message.
+func (s *SlackService) PostText(ctx context.Context, text string) error {
+	if s.Token == "" {
+		return errors.New("missing Slack token")
+	}
+
+	log.Printf("Notice: %s", text)
+
+	// Don't send to Slack
+	if strings.HasPrefix(s.Token, "-") {
+		return nil
+	}
+
+	slackWebhookURL := fmt.Sprintf("https://hooks.slack.com/services/%s", s.Token)
+	return slack.PostWebhookCustomHTTPContext(ctx, slackWebhookURL, httpClient, &slack.WebhookMessage{Text: text})
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"text/template"
+
+	"github.com/dnsimple/dnsimple-go/v7/dnsimple/webhook"
+	"github.com/dnsimple/strillone/internal/config"
+)
+
+// Message formats the event in the style, with its template and the links to
+// its DNSimple URL when set.
+func (s Style) Message(m MessagingService, e *webhook.Event) string {
+	baseURL := s.DNSimpleURL
+	if baseURL == "" {
+		baseURL = config.Config.DNSimpleURL
+	}
+
+	if s.Template != nil {
+		text, err := s.Template.render(m, e, baseURL)
+		if err == nil && text != "" {
+			return text
+		}
+		// Publish the default message rather than lose the event.
+		if err != nil {
+			log.Printf("[event:%v] Error rendering the message template: %v\n", e.RequestID, err)
+		}
+	}
+	return message(m, e, baseURL)
+}
+
+// Template is a parsed message template. It is encoded as its text, so that
+// the styles kept in the outbox and the dead-letter queue keep it.
+type Template struct {
+	text string
+	tmpl *template.Template
+}
+
+// ParseTemplate parses a message template.
+func ParseTemplate(text string) (*Template, error) {
+	tmpl, err := template.New("message").Funcs(templateFuncs(nil, "")).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	return &Template{text: text, tmpl: tmpl}, nil
+}
+
+// String returns the text of the template.
+func (t *Template) String() string {
+	if t == nil {
+		return ""
+	}
+	return t.text
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (t *Template) MarshalText() ([]byte, error) {
+	return []byte(t.text), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (t *Template) UnmarshalText(text []byte) error {
+	parsed, err := ParseTemplate(string(text))
+	if err != nil {
+		return err
+	}
+	*t = *parsed
+	return nil
+}
+
+// templateFuncs returns the functions formatting the links for m, and the
+// URLs of the DNSimple app at baseURL.
+func templateFuncs(m MessagingService, baseURL string) template.FuncMap {
+	return template.FuncMap{
+		"link": func(name, url string) string {
+			return m.FormatLink(name, url)
+		},
+		"url": func(path string, a ...any) string {
+			return fmt.Sprintf(baseURL+path, a...)
+		},
+	}
+}
+
+// render formats the event with the template. The template is executed with
+// the view of the event, plus the default message as "text".
+func (t *Template) render(m MessagingService, e *webhook.Event, baseURL string) (string, error) {
+	// The functions are bound to the destination on a copy, as the template
+	// is shared by the concurrent deliveries.
+	tmpl, err := t.tmpl.Clone()
+	if err != nil {
+		return "", err
+	}
+	tmpl.Funcs(templateFuncs(m, baseURL))
+
+	view, err := EventView(e)
+	if err != nil {
+		return "", err
+	}
+	view["text"] = message(m, e, baseURL)
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, view); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(b.String()), nil
+}
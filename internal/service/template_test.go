@@ -0,0 +1,86 @@
+package service_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/dnsimple/dnsimple-go/v7/dnsimple/webhook"
+	xservice "github.com/dnsimple/strillone/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStyle_Message(t *testing.T) {
+	payload := `{"name": "domain.create", "actor": {"pretty": "john.doe@email.com"}, "account": {"id": 1010, "display": "Brand A"}, "data": {"domain": {"id": 1, "name": "example.com"}}}`
+	event, err := webhook.ParseEvent([]byte(payload))
+	require.NoError(t, err)
+	service := NewTestMessagingService("dummyMessagingService")
+
+	tests := []struct {
+		name  string
+		style xservice.Style
+		text  string
+	}{
+		{
+			name:  "default",
+			style: xservice.Style{},
+			text:  "[<Brand A|https://dnsimple.com/a/1010/account>] john.doe@email.com created the domain <example.com|https://dnsimple.com/a/1010/domains/example.com>",
+		},
+		{
+			name:  "DNSimple URL",
+			style: xservice.Style{DNSimpleURL: "https://dnsimple.brand-a.test"},
+			text:  "[<Brand A|https://dnsimple.brand-a.test/a/1010/account>] john.doe@email.com created the domain <example.com|https://dnsimple.brand-a.test/a/1010/domains/example.com>",
+		},
+		{
+			name:  "template",
+			style: xservice.Style{DNSimpleURL: "https://dnsimple.brand-a.test", Template: mustParseTemplate(t, `{{.actor.pretty}} added {{link .domain (url "/a/%v/domains" .account.id)}}`)},
+			text:  "john.doe@email.com added <example.com|https://dnsimple.brand-a.test/a/1010/domains>",
+		},
+		{
+			name:  "template wrapping the default message",
+			style: xservice.Style{Template: mustParseTemplate(t, `:globe_with_meridians: {{.text}}`)},
+			text:  ":globe_with_meridians: [<Brand A|https://dnsimple.com/a/1010/account>] john.doe@email.com created the domain <example.com|https://dnsimple.com/a/1010/domains/example.com>",
+		},
+		{
+			name:  "failing template",
+			style: xservice.Style{Template: mustParseTemplate(t, `{{.data.domain.name.missing}}`)},
+			text:  "[<Brand A|https://dnsimple.com/a/1010/account>] john.doe@email.com created the domain <example.com|https://dnsimple.com/a/1010/domains/example.com>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.text, tt.style.Message(service, event))
+		})
+	}
+}
+
+func mustParseTemplate(t *testing.T, text string) *xservice.Template {
+	t.Helper()
+
+	template, err := xservice.ParseTemplate(text)
+	require.NoError(t, err)
+	return template
+}
+
+func TestParseTemplate(t *testing.T) {
+	template, err := xservice.ParseTemplate(`{{link .domain (url "/a/%v/domains" .account.id)}}`)
+	require.NoError(t, err)
+	assert.Equal(t, `{{link .domain (url "/a/%v/domains" .account.id)}}`, template.String())
+
+	_, err = xservice.ParseTemplate(`{{.domain`)
+	assert.Error(t, err)
+	_, err = xservice.ParseTemplate(`{{unknown .domain}}`)
+	assert.Error(t, err)
+}
+
+func TestTemplate_JSON(t *testing.T) {
+	style := xservice.Style{Template: mustParseTemplate(t, `:globe_with_meridians: {{.text}}`)}
+	data, err := json.Marshal(style)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"template": ":globe_with_meridians: {{.text}}"}`, string(data))
+
+	var decoded xservice.Style
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, style.Template.String(), decoded.Template.String())
+	assert.Error(t, json.Unmarshal([]byte(`{"template": "{{.text"}`), &decoded))
+}
@@ -0,0 +1,203 @@
+// Package throttle caps and samples the high-volume events, such as the
+// zone record updates of the dynamic DNS clients, and summarizes the events
+// it drops.
+package throttle
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dnsimple/strillone/internal/service"
+)
+
+// shutdownTimeout bounds the posting of the pending summaries at shutdown.
+const shutdownTimeout = 10 * time.Second
+
+// maxSummaryLines is the number of event types listed in a summary.
+const maxSummaryLines = 20
+
+// Limits are the caps and the sampling of the events of a route.
+type Limits struct {
+	// Count is the number of events of each type published per period, no
+	// limit when 0.
+	Count int
+	Per   time.Duration
+	// Sample is the fraction of the events published, all of them when 0.
+	Sample float64
+}
+
+// IsZero reports whether the limits let every event through.
+func (l Limits) IsZero() bool {
+	return l == Limits{}
+}
+
+// Drop is a kind of event dropped for a destination.
+type Drop struct {
+	Destination string
+	Event       string
+	Domain      string
+}
+
+// Throttle counts the events of the capped routes, and the dropped events
+// until they are summarized.
+type Throttle struct {
+	mu      sync.Mutex
+	windows map[windowKey]*window
+	dropped map[Drop]int
+	random  func() float64
+}
+
+type windowKey struct {
+	route string
+	event string
+}
+
+// window is a fixed period of a cap.
+type window struct {
+	end   time.Time
+	count int
+}
+
+// New returns an empty throttle.
+func New() *Throttle {
+	return &Throttle{
+		windows: make(map[windowKey]*window),
+		dropped: make(map[Drop]int),
+		random:  rand.Float64,
+	}
+}
+
+// Allow reports whether the event of the given type may be published by
+// the route at now. The sampled out events don't count toward the cap.
+func (t *Throttle) Allow(route, event string, limits Limits, now time.Time) bool {
+	if limits.Sample > 0 && t.random() >= limits.Sample {
+		return false
+	}
+	if limits.Count <= 0 {
+		return true
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	k := windowKey{route, event}
+	w, ok := t.windows[k]
+	if !ok || !now.Before(w.end) {
+		w = &window{end: now.Truncate(limits.Per).Add(limits.Per)}
+		t.windows[k] = w
+	}
+	if w.count >= limits.Count {
+		return false
+	}
+	w.count++
+	return true
+}
+
+// Record counts a dropped event, to be summarized by the next flush.
+func (t *Throttle) Record(drop Drop) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.dropped[drop]++
+}
+
+// Flush posts the summaries of the events dropped since the last flush, one
+// message per destination. The counts of the summaries that could not be
+// posted are kept for the next flush.
+func (t *Throttle) Flush(ctx context.Context, now time.Time, notify service.NotifyFunc) error {
+	t.mu.Lock()
+	dropped := t.dropped
+	t.dropped = make(map[Drop]int)
+	for k, w := range t.windows {
+		if !now.Before(w.end) {
+			delete(t.windows, k)
+		}
+	}
+	t.mu.Unlock()
+
+	summaries := make(map[string][]Drop)
+	for drop := range dropped {
+		summaries[drop.Destination] = append(summaries[drop.Destination], drop)
+	}
+
+	var errs []error
+	for _, destination := range slices.Sorted(maps.Keys(summaries)) {
+		drops := summaries[destination]
+		if err := notify(ctx, destination, summaryText(drops, dropped)); err != nil {
+			errs = append(errs, err)
+			t.mu.Lock()
+			for _, drop := range drops {
+				t.dropped[drop] += dropped[drop]
+			}
+			t.mu.Unlock()
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Run flushes the summaries every interval until ctx is done, and then
+// posts the pending summaries.
+func (t *Throttle) Run(ctx context.Context, interval time.Duration, notify service.NotifyFunc) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), shutdownTimeout)
+			defer cancel()
+			if err := t.Flush(ctx, time.Now(), notify); err != nil {
+				log.Printf("Error posting the summaries of the dropped events: %v\n", err)
+			}
+			return
+		case now := <-ticker.C:
+			if err := t.Flush(ctx, now, notify); err != nil {
+				log.Printf("Error posting the summaries of the dropped events: %v\n", err)
+			}
+		}
+	}
+}
+
+// summaryText lists the dropped events, the most frequent first, such as
+// "…and 312 more zone_record.update events for example.com suppressed". The
+// events past maxSummaryLines are only counted.
+func summaryText(drops []Drop, counts map[Drop]int) string {
+	slices.SortFunc(drops, func(a, b Drop) int {
+		return cmp.Or(
+			cmp.Compare(counts[b], counts[a]),
+			cmp.Compare(a.Event, b.Event),
+			cmp.Compare(a.Domain, b.Domain),
+		)
+	})
+
+	lines := make([]string, 0, min(len(drops), maxSummaryLines+1))
+	for i, drop := range drops {
+		if i == maxSummaryLines {
+			rest := 0
+			for _, drop := range drops[i:] {
+				rest += counts[drop]
+			}
+			lines = append(lines, fmt.Sprintf("…and %d more events suppressed", rest))
+			break
+		}
+
+		noun := "events"
+		if counts[drop] == 1 {
+			noun = "event"
+		}
+		line := fmt.Sprintf("…and %d more %s %s", counts[drop], drop.Event, noun)
+		if drop.Domain != "" {
+			line += " for " + drop.Domain
+		}
+		lines = append(lines, line+" suppressed")
+	}
+	return strings.Join(lines, "\n")
+}
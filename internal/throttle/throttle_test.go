@@ -0,0 +1,102 @@
+package throttle_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dnsimple/strillone/internal/throttle"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestThrottle_AllowCap(t *testing.T) {
+	events := throttle.New()
+	limits := throttle.Limits{Count: 2, Per: time.Minute}
+	now := time.Date(2026, 10, 19, 12, 0, 10, 0, time.UTC)
+
+	assert.True(t, events.Allow("routes[0]", "zone_record.update", limits, now))
+	assert.True(t, events.Allow("routes[0]", "zone_record.update", limits, now))
+	assert.False(t, events.Allow("routes[0]", "zone_record.update", limits, now.Add(30*time.Second)))
+
+	// The caps are per route and per event type.
+	assert.True(t, events.Allow("routes[0]", "zone_record.create", limits, now))
+	assert.True(t, events.Allow("routes[1]", "zone_record.update", limits, now))
+
+	// The windows are aligned on the period.
+	assert.True(t, events.Allow("routes[0]", "zone_record.update", limits, now.Add(50*time.Second)))
+}
+
+func TestThrottle_AllowSample(t *testing.T) {
+	events := throttle.New()
+	limits := throttle.Limits{Sample: 0.1}
+	now := time.Now()
+
+	allowed := 0
+	for range 10000 {
+		if events.Allow("routes[0]", "zone_record.update", limits, now) {
+			allowed++
+		}
+	}
+	assert.InDelta(t, 1000, allowed, 200)
+}
+
+func TestThrottle_Flush(t *testing.T) {
+	events := throttle.New()
+	for range 312 {
+		events.Record(throttle.Drop{Destination: "slack/T1/B1/ops", Event: "zone_record.update", Domain: "example.com"})
+	}
+	events.Record(throttle.Drop{Destination: "slack/T1/B1/ops", Event: "zone_record.create", Domain: "example.com"})
+	events.Record(throttle.Drop{Destination: "slack/T1/B2/dns", Event: "zone_record.update"})
+	events.Record(throttle.Drop{Destination: "slack/T1/B2/dns", Event: "zone_record.update"})
+
+	posted := map[string]string{}
+	failing := true
+	notify := func(_ context.Context, destination, text string) error {
+		if failing && destination == "slack/T1/B2/dns" {
+			return errors.New("unavailable")
+		}
+		posted[destination] = text
+		return nil
+	}
+
+	require.Error(t, events.Flush(context.Background(), time.Now(), notify))
+	assert.Equal(t, map[string]string{
+		"slack/T1/B1/ops": "…and 312 more zone_record.update events for example.com suppressed\n…and 1 more zone_record.create event for example.com suppressed",
+	}, posted)
+
+	// The summaries that could not be posted are kept.
+	failing = false
+	clear(posted)
+	require.NoError(t, events.Flush(context.Background(), time.Now(), notify))
+	assert.Equal(t, map[string]string{
+		"slack/T1/B2/dns": "…and 2 more zone_record.update events suppressed",
+	}, posted)
+
+	clear(posted)
+	require.NoError(t, events.Flush(context.Background(), time.Now(), notify))
+	assert.Empty(t, posted)
+}
+
+func TestThrottle_FlushLongSummary(t *testing.T) {
+	events := throttle.New()
+	for i := range 25 {
+		for range 25 - i {
+			events.Record(throttle.Drop{Destination: "slack/T1/B1/ops", Event: "zone_record.update", Domain: fmt.Sprintf("host%02d.example.com", i)})
+		}
+	}
+
+	var text string
+	require.NoError(t, events.Flush(context.Background(), time.Now(), func(_ context.Context, _, summary string) error {
+		text = summary
+		return nil
+	}))
+
+	lines := strings.Split(text, "\n")
+	require.Len(t, lines, 21)
+	assert.Equal(t, "…and 25 more zone_record.update events for host00.example.com suppressed", lines[0])
+	assert.Equal(t, "…and 15 more events suppressed", lines[20])
+}